@@ -0,0 +1,40 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code limits the total number of AWS API calls made in a single run.  It acts as a circuit
+// breaker against misconfigurations that would otherwise make an unbounded number of calls.
+//
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// The number of API calls made so far in this run
+var apiCalls int64
+
+// This function will add the middleware that counts each API operation to the stack of every client
+// created from the config
+func addAPICallLimit(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("APICallLimit", limitAPICalls), middleware.After)
+}
+
+// This function will count the API operation and fail it once -max-api-calls has been exceeded
+func limitAPICalls(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	calls := atomic.AddInt64(&apiCalls, 1)
+	operation := awsmiddleware.GetServiceID(ctx) + " " + awsmiddleware.GetOperationName(ctx)
+
+	if calls > int64(maxAPICalls) {
+		return middleware.InitializeOutput{}, middleware.Metadata{}, fmt.Errorf("aborting %s as it would exceed the limit of %d API calls set by -max-api-calls", operation, maxAPICalls)
+	}
+
+	logVerbose("API call %d of %d: %s", calls, maxAPICalls, operation)
+
+	return next.HandleInitialize(ctx, in)
+}
@@ -0,0 +1,97 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code caches the credentials of an assumed role between runs, in the same way as the AWS CLI,
+// so that repeated local runs do not assume the role every time.  The cache is keyed by the role ARN
+// and session name, only readable by the owner, and entries are reused until they are close to expiry.
+//
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+// The directory under the user cache directory that holds cached credentials
+const CRED_CACHE_DIR = "go-retrieve-secret"
+
+// Cached credentials are not reused when they expire within this window
+const CRED_CACHE_EXPIRY_WINDOW = 5 * time.Minute
+
+// This function will return the path of the cache file for the -a role and -n session name
+func credCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(roleArn + "\x00" + sessionName))
+
+	return filepath.Join(dir, CRED_CACHE_DIR, hex.EncodeToString(sum[:])+".json"), nil
+}
+
+// This function will return the cached assumed role, or nil when there is no usable cache entry
+func readCachedRole() *sts.AssumeRoleOutput {
+	path, err := credCachePath()
+
+	if err != nil {
+		logVerbose("Credential cache unavailable: %s", err.Error())
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil
+	}
+
+	var creds types.Credentials
+	if err := json.Unmarshal(content, &creds); err != nil || creds.AccessKeyId == nil || creds.SecretAccessKey == nil || creds.SessionToken == nil || creds.Expiration == nil {
+		logVerbose("Ignoring invalid cached credentials in %s", path)
+		return nil
+	}
+
+	if time.Until(*creds.Expiration) < CRED_CACHE_EXPIRY_WINDOW {
+		logVerbose("Cached credentials for %s have expired", roleArn)
+		return nil
+	}
+
+	logVerbose("Using cached credentials for %s until %s", roleArn, creds.Expiration.Format(time.RFC3339))
+
+	return &sts.AssumeRoleOutput{Credentials: &creds}
+}
+
+// This function will store the credentials of the assumed role in the cache.  Failures are only
+// logged since the cache is an optimisation.
+func writeCachedRole(role *sts.AssumeRoleOutput) {
+	path, err := credCachePath()
+
+	if err != nil {
+		logVerbose("Credential cache unavailable: %s", err.Error())
+		return
+	}
+
+	content, err := json.Marshal(role.Credentials)
+
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(path), 0700)
+	}
+
+	if err == nil {
+		err = writePrivateFile(path, content)
+	}
+
+	if err != nil {
+		logVerbose("Failed to cache credentials for %s: %s", roleArn, err.Error())
+	}
+}
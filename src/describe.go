@@ -0,0 +1,195 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code outputs and checks the metadata of a secret as reported by DescribeSecret.  DescribeSecret
+// does not return any secret value, so nothing printed here can contain value material.
+//
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// The staging labels used by Secrets Manager rotation
+const STAGE_CURRENT = "AWSCURRENT"
+const STAGE_PENDING = "AWSPENDING"
+
+// How often the secret is described while waiting for a rotation to complete
+const ROTATION_POLL_INTERVAL = time.Second
+
+// The metadata of a secret as output by -describe
+type secretMetadata struct {
+	ARN                string              `json:"arn"`
+	Name               string              `json:"name"`
+	Description        string              `json:"description,omitempty"`
+	KmsKeyId           string              `json:"kmsKeyId,omitempty"`
+	OwningService      string              `json:"owningService,omitempty"`
+	PrimaryRegion      string              `json:"primaryRegion,omitempty"`
+	RotationEnabled    bool                `json:"rotationEnabled"`
+	RotationLambdaARN  string              `json:"rotationLambdaArn,omitempty"`
+	RotationAfterDays  int64               `json:"rotationAfterDays,omitempty"`
+	Tags               map[string]string   `json:"tags"`
+	VersionIdsToStages map[string][]string `json:"versionIdsToStages"`
+	ReplicationRegions []replicaMetadata   `json:"replicationStatus,omitempty"`
+	CreatedDate        *time.Time          `json:"createdDate,omitempty"`
+	LastChangedDate    *time.Time          `json:"lastChangedDate,omitempty"`
+	LastAccessedDate   *time.Time          `json:"lastAccessedDate,omitempty"`
+	LastRotatedDate    *time.Time          `json:"lastRotatedDate,omitempty"`
+	DeletedDate        *time.Time          `json:"deletedDate,omitempty"`
+}
+
+// The replication status of a secret in one of its replica regions
+type replicaMetadata struct {
+	Region           string     `json:"region"`
+	Status           string     `json:"status"`
+	StatusMessage    string     `json:"statusMessage,omitempty"`
+	KmsKeyId         string     `json:"kmsKeyId,omitempty"`
+	LastAccessedDate *time.Time `json:"lastAccessedDate,omitempty"`
+}
+
+// This function will describe the secret and write its metadata to the writer as indented JSON
+func PrintSecretMetadata(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput, w io.Writer) error {
+	description, err := DescribeSecret(ctx, cfg, assumedRole)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+
+	return encoder.Encode(toSecretMetadata(description))
+}
+
+// This function will copy the fields of the DescribeSecret response into the output structure
+func toSecretMetadata(description *secretsmanager.DescribeSecretOutput) secretMetadata {
+	metadata := secretMetadata{
+		ARN:                aws.ToString(description.ARN),
+		Name:               aws.ToString(description.Name),
+		Description:        aws.ToString(description.Description),
+		KmsKeyId:           aws.ToString(description.KmsKeyId),
+		OwningService:      aws.ToString(description.OwningService),
+		PrimaryRegion:      aws.ToString(description.PrimaryRegion),
+		RotationEnabled:    description.RotationEnabled,
+		RotationLambdaARN:  aws.ToString(description.RotationLambdaARN),
+		Tags:               map[string]string{},
+		VersionIdsToStages: description.VersionIdsToStages,
+		CreatedDate:        description.CreatedDate,
+		LastChangedDate:    description.LastChangedDate,
+		LastAccessedDate:   description.LastAccessedDate,
+		LastRotatedDate:    description.LastRotatedDate,
+		DeletedDate:        description.DeletedDate,
+	}
+
+	if description.RotationRules != nil {
+		metadata.RotationAfterDays = description.RotationRules.AutomaticallyAfterDays
+	}
+
+	if metadata.VersionIdsToStages == nil {
+		metadata.VersionIdsToStages = map[string][]string{}
+	}
+
+	for _, tag := range description.Tags {
+		metadata.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	for _, replica := range description.ReplicationStatus {
+		metadata.ReplicationRegions = append(metadata.ReplicationRegions, replicaMetadata{
+			Region:           aws.ToString(replica.Region),
+			Status:           string(replica.Status),
+			StatusMessage:    aws.ToString(replica.StatusMessage),
+			KmsKeyId:         aws.ToString(replica.KmsKeyId),
+			LastAccessedDate: replica.LastAccessedDate,
+		})
+	}
+
+	return metadata
+}
+
+// This function will warn when the secret has not been accessed within the last -warn-unused days,
+// which hints that it may be orphaned.  The check is informational, so failures are only logged.
+func WarnIfUnused(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) {
+	description, err := DescribeSecret(ctx, cfg, assumedRole)
+
+	if err != nil {
+		logWarning("Unable to check when secret %s was last accessed due to error %s", secretArn, err.Error())
+		return
+	}
+
+	if description.LastAccessedDate == nil {
+		logWarning("Secret %s has no recorded access and may be unused", secretArn)
+		return
+	}
+
+	days := int(time.Since(*description.LastAccessedDate).Hours() / 24)
+	if days >= warnUnusedDays {
+		logWarning("Secret %s was last accessed %d days ago on %s and may be unused", secretArn, days, description.LastAccessedDate.Format("2006-01-02"))
+	} else {
+		logVerbose("Secret %s was last accessed on %s", secretArn, description.LastAccessedDate.Format("2006-01-02"))
+	}
+}
+
+// This function will return an error when a rotation of the secret is in progress.  When -rotation-wait
+// is set, the secret is described again until the rotation completes, the wait elapses or the context ends.
+// It also reports whether it waited for a rotation to complete.
+func WaitForRotation(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) (bool, error) {
+	waitUntil := time.Now().Add(time.Duration(rotationWait) * time.Millisecond)
+
+	for waited := false; ; waited = true {
+		description, err := DescribeSecret(ctx, cfg, assumedRole)
+
+		if err != nil {
+			return waited, fmt.Errorf("Failed to check the rotation state of secret %s due to error %s", secretArn, err.Error())
+		}
+
+		pending := pendingVersion(description.VersionIdsToStages)
+		if len(pending) == 0 {
+			return waited, nil
+		}
+
+		remaining := time.Until(waitUntil)
+		if remaining <= 0 {
+			return waited, fmt.Errorf("Secret %s is being rotated (version %s is %s).  Retry once the rotation completes", secretArn, pending, STAGE_PENDING)
+		}
+
+		logVerbose("Secret %s is being rotated, waiting up to %v for the rotation to complete", secretArn, remaining.Round(time.Millisecond))
+
+		if remaining > ROTATION_POLL_INTERVAL {
+			remaining = ROTATION_POLL_INTERVAL
+		}
+
+		select {
+		case <-time.After(remaining):
+		case <-ctx.Done():
+			return waited, fmt.Errorf("Secret %s is still being rotated (version %s is %s) when the deadline was reached", secretArn, pending, STAGE_PENDING)
+		}
+	}
+}
+
+// This function will return the version ID labelled AWSPENDING, unless it is also AWSCURRENT, which
+// indicates a rotation that has been started but not finished
+func pendingVersion(versionIdsToStages map[string][]string) string {
+	for versionId, stages := range versionIdsToStages {
+		pending, current := false, false
+
+		for _, stage := range stages {
+			pending = pending || stage == STAGE_PENDING
+			current = current || stage == STAGE_CURRENT
+		}
+
+		if pending && !current {
+			return versionId
+		}
+	}
+
+	return ""
+}
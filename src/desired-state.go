@@ -0,0 +1,84 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code compares the secret with a desired state file and prints the operations that would
+// reconcile the secret with it.  Only key names are printed, so the values of neither the secret
+// nor the desired state are exposed.
+//
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+)
+
+// The kinds of operation needed to reach the desired state
+const OPERATION_ADD = "add"
+const OPERATION_UPDATE = "update"
+const OPERATION_DELETE = "delete"
+
+// A single change to a key of the secret
+type stateOperation struct {
+	Op  string `json:"op"`
+	Key string `json:"key"`
+}
+
+// This function will read the desired state file and print, as a JSON array, the operations that
+// turn the keys of the secret into those of the desired state.  The operations are sorted by key.
+func PrintDesiredStateOperations(path string, dat map[string]interface{}, w io.Writer) error {
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	desired, err := ParseSecret(string(content))
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "    ")
+
+	return encoder.Encode(DesiredStateOperations(dat, desired))
+}
+
+// This function will return the operations that turn the current values into the desired values.
+// Keys only in the desired state are added, keys in both with different values are updated, and
+// keys only in the current values are deleted.
+func DesiredStateOperations(current map[string]interface{}, desired map[string]interface{}) []stateOperation {
+	keys := []string{}
+	for key := range current {
+		keys = append(keys, key)
+	}
+	for key := range desired {
+		if _, ok := current[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	operations := []stateOperation{}
+	for _, key := range keys {
+		currentValue, inCurrent := current[key]
+		desiredValue, inDesired := desired[key]
+
+		switch {
+		case !inCurrent:
+			operations = append(operations, stateOperation{Op: OPERATION_ADD, Key: key})
+		case !inDesired:
+			operations = append(operations, stateOperation{Op: OPERATION_DELETE, Key: key})
+		case !reflect.DeepEqual(currentValue, desiredValue):
+			operations = append(operations, stateOperation{Op: OPERATION_UPDATE, Key: key})
+		}
+	}
+
+	logVerbose("%d operations are needed to reach the desired state in %s", len(operations), desiredStateFile)
+
+	return operations
+}
@@ -0,0 +1,55 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code runs a command with the secret injected into its environment.  The secret is never
+// written to disk or stdout in this mode.
+//
+package main
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+// This function will replace the current process with the command, passing the current environment
+// with each of the keys set to its secret value.  Since the process is replaced, the exit code of the
+// command becomes the exit code of this program.  This function only returns if the exec fails.
+func ExecCommand(command []string, keys []string, dat map[string]interface{}) error {
+	path, err := exec.LookPath(command[0])
+
+	if err != nil {
+		return err
+	}
+
+	// Secret values override any variable of the same name that is already set
+	env := map[string]string{}
+	names := []string{}
+	setenv := func(name string, value string) {
+		if _, ok := env[name]; !ok {
+			names = append(names, name)
+		}
+		env[name] = value
+	}
+
+	for _, entry := range os.Environ() {
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			setenv(parts[0], parts[1])
+		}
+	}
+
+	for _, key := range keys {
+		setenv(key, valueString(dat[key]))
+	}
+
+	environ := []string{}
+	for _, name := range names {
+		environ = append(environ, name+"="+env[name])
+	}
+
+	logVerbose("Executing %s with %d keys from the secret in its environment", path, len(keys))
+
+	return syscall.Exec(path, command, environ)
+}
@@ -8,9 +8,17 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path"
+	"regexp"
+	"strings"
 	"time"
 
 	"encoding/json"
@@ -18,6 +26,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
 
 	"github.com/aws/aws-sdk-go-v2/aws/retry"
@@ -28,13 +37,92 @@ import (
 const DEFAULT_TIMEOUT = 5000
 const DEFAULT_REGION = "us-east-2"
 const DEFAULT_SESSION = "param_session"
+const DEFAULT_ARRAY_NAME = "SECRETS"
+const DEFAULT_KV_SEPARATOR = "="
+const DEFAULT_LINE_SEPARATOR = "\\n"
+const DEFAULT_NETRC_MACHINE_KEY = "machine"
+const DEFAULT_NETRC_LOGIN_KEY = "login"
+const DEFAULT_NETRC_PASSWORD_KEY = "password"
+const DEFAULT_KV_PATH_SEPARATOR = "/"
+
+// Supported values for -parse
+const PARSE_PROPERTIES = "properties"
+
+// Supported values for -sort-by
+const SORT_BY_NAME = "name"
+const SORT_BY_VALUE_LENGTH = "value-length"
 
 var (
-	region      string
-	secretArn   string
-	roleArn     string
-	timeout     int
-	sessionName string
+	region                     string
+	secretArn                  string
+	roleArn                    string
+	timeout                    int
+	deadline                   string
+	deadlineTime               time.Time
+	sessionName                string
+	arnParameter               string
+	keyOrderFile               string
+	parseFormat                string
+	redactPattern              string
+	outputFormat               string
+	arrayName                  string
+	commentsFile               string
+	kvSeparator                string
+	lineSeparator              string
+	kvQuote                    bool
+	mergeOSEnv                 bool
+	requireNonEmpty            bool
+	startupJitter              int
+	outFile                    string
+	writeChecksum              bool
+	describe                   bool
+	changedSinceVersion        string
+	warnUnusedDays             int
+	normalizeNewlines          bool
+	escapeNewlines             bool
+	newlineKeys                string
+	failIfRotating             bool
+	rotationWait               int
+	secureOutFile              string
+	secureOutAck               bool
+	whoami                     bool
+	minifyJSONKeys             string
+	bestEffort                 bool
+	maxAttempts                int
+	ssoSession                 string
+	ssoAccount                 string
+	ssoRole                    string
+	ssoRegion                  string
+	fitBudget                  int
+	overflowOutFile            string
+	finalNewline               string
+	keyGlob                    string
+	journald                   bool
+	fallbackSecrets            stringList
+	fallbackRegions            stringList
+	netrcMachineKey            string
+	netrcLoginKey              string
+	netrcPasswordKey           string
+	stripControl               bool
+	stripControlKeepWhitespace bool
+	maxAPICalls                int
+	bundleVar                  string
+	validateTypesFile          string
+	validateTypesWarn          bool
+	noCredCache                bool
+	sortBy                     string
+	sortDesc                   bool
+	retryJitterSeed            int64
+	validateOnly               bool
+	defaultKeys                stringList
+	kvPrefix                   string
+	kvPathSeparator            string
+	attemptTimeout             int
+	timeoutEscalation          string
+	desiredStateFile           string
+	quoteStyle                 string
+	command                    []string
+	verbose                    bool
 )
 
 // The main function will pull command line arg and retrieve the secret.  The resulting
@@ -44,10 +132,22 @@ func main() {
 	// Get all of the command line data and perform the necessary validation
 	getCommandParams()
 
-	// Setup a new context to allow for limited execution time for API calls with a default of 200 milliseconds
-	ctx, cancel := context.WithTimeout(context.TODO(), time.Duration(timeout)*time.Millisecond)
+	// Setup a new context to allow for limited execution time for API calls with a default of 200 milliseconds,
+	// or until the absolute -deadline when one was supplied
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if deadlineTime.IsZero() {
+		ctx, cancel = context.WithTimeout(context.TODO(), time.Duration(timeout)*time.Millisecond)
+	} else {
+		ctx, cancel = context.WithDeadline(context.TODO(), deadlineTime)
+	}
 	defer cancel()
 
+	// Spread the first API call of synchronized invocations over the -startup-jitter window
+	if err := StartupJitter(ctx); err != nil {
+		fatal("Startup jitter did not complete due to error " + err.Error())
+	}
+
 	// Load the config
 	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region), config.WithRetryer(func() aws.Retryer {
 		// NopRetryer is used here in a global context to avoid retries on API calls
@@ -55,55 +155,591 @@ func main() {
 	}))
 
 	if err != nil {
-		panic("configuration error " + err.Error())
+		fatal("configuration error " + err.Error())
+	}
+
+	// Count every API call made with the config so that runaway configurations are stopped
+	if maxAPICalls > 0 {
+		cfg.APIOptions = append(cfg.APIOptions, addAPICallLimit)
+	}
+
+	// Use the IAM Identity Center (SSO) role in place of the default credential chain when requested
+	if len(ssoSession) > 0 {
+		cfg.Credentials, err = SSOCredentials(ctx, cfg)
+
+		if err != nil {
+			fatal("Failed to get SSO credentials due to error " + err.Error())
+		}
 	}
 
 	// Assume a role to retreive the parameter
 	role, err := AttemptAssumeRole(ctx, cfg)
 
 	if err != nil {
-		panic("Failed to assume role due to error " + err.Error())
+		fatal("Failed to assume role due to error " + err.Error())
+	}
+
+	// Report the identity the API calls are made as, either as the only output of -whoami or as a
+	// diagnostic under -verbose
+	if whoami || verbose {
+		identity, err := GetCallerIdentity(ctx, cfg, role)
+
+		if whoami {
+			if err != nil {
+				fatal("Failed to get caller identity due to error " + err.Error())
+			}
+
+			fmt.Println(identity)
+			return
+		}
+
+		if err != nil {
+			logVerbose("Unable to get caller identity due to error %s", err.Error())
+		} else {
+			logVerbose("Running as %s", identity)
+		}
 	}
 
-	// Get the secret
-	result, err := GetSecret(ctx, cfg, role)
+	// Look up the ARN of the secret when it is published through SSM
+	if len(arnParameter) > 0 {
+		secretArn, err = GetSecretArnFromSSM(ctx, cfg, role)
+
+		if err != nil {
+			fatal("Failed to resolve secret ARN from SSM parameter " + arnParameter + " due to error " + err.Error())
+		}
+
+		logVerbose("Resolved secret ARN %s from SSM parameter %s", secretArn, arnParameter)
+	}
+
+	// Print the metadata of the secret instead of its value.  Describing is the only call made in this
+	// mode, so each -fallback-secret is tried in turn while the secret cannot be described.
+	if describe {
+		if err := withFallback(&cfg, "describe", func() error { return PrintSecretMetadata(ctx, cfg, role, os.Stdout) }); err != nil {
+			fatal("Failed to describe secret due to error " + err.Error())
+		}
+		return
+	}
+
+	// Get the secret, trying each -fallback-secret in turn while the secret cannot be read.  Only a
+	// failure to read the secret moves to a fallback, since a role may be allowed to read a secret
+	// without being allowed to describe it.
+	var result *secretsmanager.GetSecretValueOutput
+	err = withFallback(&cfg, "retrieve", func() error {
+		// Warn when the secret looks unused.  This is checked before retrieving the value since the
+		// retrieval itself updates the last accessed date, and only logs so it never causes a fallback.
+		if warnUnusedDays > 0 {
+			WarnIfUnused(ctx, cfg, role)
+		}
+
+		var err error
+		result, err = GetSecret(ctx, cfg, role)
+		return err
+	})
 
 	if err != nil {
-		panic("Failed to retrieve secret due to error " + err.Error())
+		fatal("Failed to retrieve secret due to error " + err.Error())
+	}
+
+	// Make sure the secret that was retrieved is not in the middle of a rotation, which could produce an
+	// inconsistent value.  When the rotation had to be waited for, the value is retrieved again.
+	if failIfRotating {
+		waited, err := WaitForRotation(ctx, cfg, role)
+
+		if err != nil {
+			fatal(err.Error())
+		}
+
+		if waited {
+			if result, err = GetSecret(ctx, cfg, role); err != nil {
+				fatal("Failed to retrieve secret due to error " + err.Error())
+			}
+		}
 	}
 
 	// Convert the secret into JSON
-	var dat map[string]interface{}
+	dat, err := ParseSecret(*result.SecretString)
+
+	if err != nil {
+		fatal("Failed to convert Secret to JSON due to error " + err.Error())
+	}
+
+	// Print the operations that reconcile the secret with the -desired-state file instead of its values
+	if len(desiredStateFile) > 0 {
+		if err := PrintDesiredStateOperations(desiredStateFile, dat, os.Stdout); err != nil {
+			fatal("Failed to compare the secret with " + desiredStateFile + " due to error " + err.Error())
+		}
+		return
+	}
+
+	// Only keep the values that changed since the -changed-since-version version of the secret
+	var changedDefaults map[string]bool
+	if len(changedSinceVersion) > 0 {
+		previous, err := GetSecretVersion(ctx, cfg, role, changedSinceVersion)
+
+		if err != nil {
+			fatal("Failed to retrieve secret version " + changedSinceVersion + " due to error " + err.Error())
+		}
+
+		previousDat, err := ParseSecret(*previous.SecretString)
+
+		if err != nil {
+			fatal("Failed to convert Secret version " + changedSinceVersion + " to JSON due to error " + err.Error())
+		}
+
+		// Both versions have the same defaults, so a default is only output when it changed
+		if len(defaultKeys) > 0 {
+			changedDefaults = ChangedDefaults(dat, previousDat)
+		}
+
+		logVerbose("Comparing secret version %s against version %s", aws.ToString(result.VersionId), aws.ToString(previous.VersionId))
+		dat = ChangedValues(dat, previousDat)
+	}
+
+	// Layer the secret over the process environment so the output is the complete effective environment
+	if mergeOSEnv {
+		dat = MergeOSEnv(dat)
+	}
+
+	// Supply the -default-key values for any keys that are still missing.  Defaults are the lowest
+	// layer, so neither the secret nor the environment is ever replaced by one.
+	if len(defaultKeys) > 0 {
+		dat = ApplyDefaults(dat, changedDefaults)
+	}
+
+	// Only keep the keys that match the -glob pattern
+	if len(keyGlob) > 0 {
+		dat = FilterGlob(dat)
+	}
+
+	// Determine the order in which the keys will be output
+	keys, err := OrderKeys(dat)
+
+	if err != nil {
+		fatal("Failed to order the secret keys due to error " + err.Error())
+	}
+
+	// Apply the requested value transforms to the keys that will be output
+	if err := TransformValues(keys, dat); err != nil {
+		fatal("Failed to transform the secret values due to error " + err.Error())
+	}
 
-	// Convert the secret to JSON
-	if err := json.Unmarshal([]byte(*result.SecretString), &dat); err != nil {
-		fmt.Println("Failed to convert Secret to JSON")
-		fmt.Println(err)
-		panic(err)
+	// Make sure that none of the values to be output are empty
+	if requireNonEmpty {
+		if err := RequireNonEmpty(keys, dat); err != nil {
+			fatal("Secret validation failed: " + err.Error())
+		}
 	}
 
-	// Get the secret value and dump the output in a manner that a shell script can read the
-	// data from the output
-	for key, value := range dat {
-		fmt.Printf("%s|%s\n", key, value)
+	// Make sure that the values have the types listed in the -validate-types-file
+	if len(validateTypesFile) > 0 {
+		if err := ValidateTypes(keys, dat); err != nil {
+			fatal("Secret validation failed: " + err.Error())
+		}
 	}
+
+	// Read the descriptions of the keys for formats that support comments, including those written to
+	// the -overflow-out file
+	if len(commentsFile) > 0 {
+		keyComments, err = ReadCommentsFile(commentsFile)
+
+		if err != nil {
+			fatal("Failed to read comments file " + commentsFile + " due to error " + err.Error())
+		}
+	}
+
+	// Keep the smallest values inline within the -fit-budget and move the rest to the -overflow-out file
+	if fitBudget > 0 {
+		inline, overflow := FitBudget(keys, dat)
+
+		if len(overflowOutFile) > 0 && !validateOnly {
+			var overflowOutput bytes.Buffer
+			if err := WriteOutput(&overflowOutput, overflow, dat); err != nil {
+				fatal("Failed to output the overflow keys due to error " + err.Error())
+			}
+
+			if err := writePrivateFile(overflowOutFile, overflowOutput.Bytes()); err != nil {
+				fatal("Failed to write " + overflowOutFile + " due to error " + err.Error())
+			}
+
+			keys = inline
+		}
+	}
+
+	// Stop before any of the values are output.  The output is still rendered and discarded, since
+	// formats such as netrc make checks of their own.
+	if validateOnly {
+		if err := WriteOutput(ioutil.Discard, keys, dat); err != nil {
+			fatal("Secret validation failed: " + err.Error())
+		}
+
+		fmt.Fprintln(os.Stderr, "Secret validation passed")
+		return
+	}
+
+	// Record that the secret was loaded, and which keys it provided, in the systemd journal
+	if journald {
+		LogLoadedToJournal(keys)
+	}
+
+	// When a command follows --, run it with the secret in its environment instead of writing any output
+	if len(command) > 0 {
+		if err := ExecCommand(command, keys, dat); err != nil {
+			fatal("Failed to execute " + command[0] + " due to error " + err.Error())
+		}
+	}
+
+	// Get the secret value and dump the output in the requested format.  The default format is
+	// one that a shell script can read the data from.
+	var output bytes.Buffer
+	if err := WriteOutput(&output, keys, dat); err != nil {
+		fatal("Failed to output the secret due to error " + err.Error())
+	}
+
+	// Only write to the -secure-out file once its location has been verified
+	if len(secureOutFile) > 0 {
+		if err := VerifySecureOutPath(secureOutFile); err != nil {
+			fatal("Refusing to write " + secureOutFile + ": " + err.Error())
+		}
+
+		outFile = secureOutFile
+	}
+
+	// Write the output to stdout, or to the -out file along with its optional checksum
+	if len(outFile) > 0 {
+		if err := WriteOutputFile(outFile, output.Bytes(), outFile == secureOutFile); err != nil {
+			fatal("Failed to write " + outFile + " due to error " + err.Error())
+		}
+	} else if _, err := os.Stdout.Write(output.Bytes()); err != nil {
+		fatal("Failed to output the secret due to error " + err.Error())
+	}
+}
+
+// A flag that can be supplied more than once, collecting each value in order
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
 }
 
 func getCommandParams() {
 	// Setup command line args
 	flag.StringVar(&region, "r", DEFAULT_REGION, "The Amazon Region to use")
 	flag.StringVar(&secretArn, "s", "", "The ARN for the secret to access")
+	flag.Var(&fallbackSecrets, "fallback-secret", "The ARN of a secret to use when the secret cannot be read (may be repeated)")
+	flag.Var(&fallbackRegions, "fallback-region", "The region of the matching -fallback-secret (may be repeated, defaults to the region of the ARN)")
+	flag.Var(&defaultKeys, "default-key", "A KEY=DEFAULT value to output when KEY is missing from the secret (may be repeated)")
 	flag.StringVar(&roleArn, "a", "", "The ARN for the role to assume for Secret Access")
+	flag.StringVar(&ssoSession, "sso-session", "", "The name of an IAM Identity Center sso-session that has been logged in with aws sso login")
+	flag.StringVar(&ssoAccount, "sso-account", "", "The account ID of the -sso-role")
+	flag.StringVar(&ssoRole, "sso-role", "", "The name of the IAM Identity Center permission set role to use")
+	flag.StringVar(&ssoRegion, "sso-region", "", "The region of the IAM Identity Center instance (defaults to the region of the cached login)")
 	flag.IntVar(&timeout, "t", DEFAULT_TIMEOUT, "The amount of time to wait for any API call")
+	flag.StringVar(&deadline, "deadline", "", "An RFC3339 timestamp by which all API calls must complete (instead of -t)")
+	flag.IntVar(&startupJitter, "startup-jitter", 0, "The maximum random delay in milliseconds before the first API call")
+	flag.IntVar(&maxAPICalls, "max-api-calls", 0, "Abort once more than this many AWS API calls have been made (default no limit)")
+	flag.IntVar(&maxAttempts, "max-attempts", DEFAULT_MAX_ATTEMPTS, "The maximum number of attempts for the STS AssumeRole and Secrets Manager GetSecretValue calls")
+	flag.IntVar(&attemptTimeout, "attempt-timeout", 0, "The amount of time in milliseconds to wait for each attempt of the STS AssumeRole and Secrets Manager GetSecretValue calls, 0 waits until the -t timeout")
+	flag.StringVar(&timeoutEscalation, "timeout-retry-escalation", ESCALATION_NONE, "How -attempt-timeout grows with each retry of the STS AssumeRole and Secrets Manager GetSecretValue calls, either none, linear or exponential")
+	flag.Int64Var(&retryJitterSeed, "retry-jitter-seed", 0, "Seed the retry jitter so the backoff delays are reproducible, 0 seeds from the current time")
 	flag.StringVar(&sessionName, "n", DEFAULT_SESSION, "The name of the session for AWS STS")
+	flag.BoolVar(&noCredCache, "no-cred-cache", false, "Do not cache the credentials of the -a role between runs")
+	flag.StringVar(&arnParameter, "arn-from-ssm", "", "The name of an SSM parameter holding the ARN for the secret to access (instead of -s)")
+	flag.StringVar(&desiredStateFile, "desired-state", "", "A JSON file of the intended keys and values.  The add, update and delete operations needed to reach it are printed instead of the secret")
+	flag.StringVar(&changedSinceVersion, "changed-since-version", "", "Only output the keys whose values differ between this version ID and the current version")
+	flag.StringVar(&keyGlob, "glob", "", "Only output the keys matching this shell style pattern, such as DB_* or *_URL")
+	flag.StringVar(&keyOrderFile, "key-order", "", "A file listing keys, one per line, to output first and in that order")
+	flag.StringVar(&sortBy, "sort-by", SORT_BY_NAME, "The order of keys not listed in -key-order, either name or value-length")
+	flag.BoolVar(&sortDesc, "sort-desc", false, "Sort the keys in descending order")
+	flag.StringVar(&parseFormat, "parse", "", "The format to parse the secret as when it is not JSON (properties)")
+	flag.StringVar(&redactPattern, "redact-pattern", "", "A regular expression whose matches are replaced with *** in all log output")
+	flag.StringVar(&outputFormat, "o", OUTPUT_PIPE, "The output format ("+strings.Join(OutputFormats(), ", ")+")")
+	flag.StringVar(&arrayName, "array-name", DEFAULT_ARRAY_NAME, "The name of the associative array declared by -o "+OUTPUT_BASH_ASSOC)
+	flag.StringVar(&kvSeparator, "kv-sep", DEFAULT_KV_SEPARATOR, "The separator between each key and value for -o "+OUTPUT_KEYVALUE+" (escapes such as \\t are supported)")
+	flag.StringVar(&lineSeparator, "line-sep", DEFAULT_LINE_SEPARATOR, "The separator written after each line for -o "+OUTPUT_KEYVALUE+" (escapes such as \\n are supported)")
+	flag.StringVar(&quoteStyle, "quote-style", QUOTE_AUTO, "How values are quoted for -o "+OUTPUT_DOTENV+", -o "+OUTPUT_KEYVALUE+" and -o "+OUTPUT_COLON+", either none, single, double or auto to only quote when needed")
+	flag.BoolVar(&kvQuote, "kv-quote", false, "Double quote values for -o "+OUTPUT_KEYVALUE+" when they contain separators, quotes or surrounding whitespace")
+	flag.BoolVar(&normalizeNewlines, "normalize-newlines", false, "Convert literal \\n sequences in values into real newlines")
+	flag.BoolVar(&escapeNewlines, "escape-newlines", false, "Convert real newlines in values into literal \\n sequences")
+	flag.StringVar(&newlineKeys, "newline-keys", "", "A comma separated list of keys that -normalize-newlines and -escape-newlines apply to (default all keys)")
+	flag.BoolVar(&stripControl, "strip-control", false, "Remove ANSI escape sequences and control characters, including newlines and tabs, from values")
+	flag.BoolVar(&stripControlKeepWhitespace, "strip-control-keep-whitespace", false, "Keep newlines and tabs when using -strip-control")
+	flag.StringVar(&minifyJSONKeys, "minify-json-values", "", "A comma separated list of keys whose values are JSON documents to output in compact form")
+	flag.BoolVar(&bestEffort, "best-effort", false, "Warn and output the original value instead of failing when a value transform cannot be applied")
+	flag.StringVar(&finalNewline, "final-newline", "", "Whether the output ends with a newline, true or false (default as written by the format, which ends each line with a newline)")
+	flag.StringVar(&outFile, "out", "", "A file to write the output to, with 0600 permissions, instead of stdout")
+	flag.StringVar(&secureOutFile, "secure-out", "", "Like -out, but only writes to a memory backed (tmpfs) or non world accessible directory")
+	flag.BoolVar(&secureOutAck, "secure-out-ack", false, "Allow -secure-out on platforms where the filesystem type cannot be verified")
+	flag.BoolVar(&writeChecksum, "write-checksum", false, "Write a sha256sum compatible FILE.sha256 alongside the -out or -secure-out file")
+	flag.IntVar(&fitBudget, "fit-budget", 0, "Report which keys do not fit within this many bytes of KEY and VALUE, such as the 4096 byte Lambda environment limit")
+	flag.StringVar(&overflowOutFile, "overflow-out", "", "A file to write the keys that do not fit within -fit-budget to, removing them from the output")
+	flag.StringVar(&netrcMachineKey, "netrc-machine-key", DEFAULT_NETRC_MACHINE_KEY, "The key holding the machine name for -o "+OUTPUT_NETRC)
+	flag.StringVar(&netrcLoginKey, "netrc-login-key", DEFAULT_NETRC_LOGIN_KEY, "The key holding the login for -o "+OUTPUT_NETRC)
+	flag.StringVar(&netrcPasswordKey, "netrc-password-key", DEFAULT_NETRC_PASSWORD_KEY, "The key holding the password for -o "+OUTPUT_NETRC)
+	flag.StringVar(&kvPrefix, "kv-prefix", "", "The path that keys are written under for -o "+OUTPUT_KV_PATHS+" and -o "+OUTPUT_KV_JSON)
+	flag.StringVar(&kvPathSeparator, "kv-path-sep", DEFAULT_KV_PATH_SEPARATOR, "The separator between the segments of the paths for -o "+OUTPUT_KV_PATHS+" and -o "+OUTPUT_KV_JSON)
+	flag.StringVar(&bundleVar, "bundle-var", "", "The variable name to assign the -o "+OUTPUT_ENV_BUNDLE+" value to, as NAME=BUNDLE")
+	flag.StringVar(&commentsFile, "comments-file", "", "A file of KEY=description lines emitted as comments above each key by formats that support comments")
+	flag.BoolVar(&mergeOSEnv, "merge-os-env", false, "Output the current process environment with the secret values layered on top")
+	flag.StringVar(&validateTypesFile, "validate-types-file", "", "A file of KEY=TYPE lines (int, bool, url or email) that the values of those keys must match")
+	flag.BoolVar(&validateTypesWarn, "validate-types-warn", false, "Only warn, rather than fail, when a value does not match its -validate-types-file type")
+	flag.BoolVar(&requireNonEmpty, "require-nonempty", false, "Fail when any value to be output is empty")
+	flag.BoolVar(&validateOnly, "validate-only", false, "Run all of the checks on the secret and exit without outputting any values")
+	flag.BoolVar(&whoami, "whoami", false, "Print the account, ARN and user ID that API calls are made as (after any -a role) and exit")
+	flag.BoolVar(&describe, "describe", false, "Print the metadata of the secret as JSON without retrieving its value")
+	flag.BoolVar(&failIfRotating, "fail-if-rotating", false, "Fail when a rotation of the secret is in progress")
+	flag.IntVar(&rotationWait, "rotation-wait", 0, "The number of milliseconds -fail-if-rotating waits for a rotation to complete before failing")
+	flag.IntVar(&warnUnusedDays, "warn-unused", 0, "Warn when the secret has not been accessed in this many days")
+	flag.BoolVar(&journald, "journald", false, "Log a structured message listing the loaded keys, but not their values, to the systemd journal (or stderr when unavailable)")
+	flag.BoolVar(&verbose, "verbose", false, "Log additional diagnostic information to stderr")
 
 	// Parse all of the command line args into the specified vars with the defaults
 	flag.Parse()
 
+	// Compile the redaction pattern up front so that it applies to every log message
+	if len(redactPattern) > 0 {
+		pattern, err := regexp.Compile(redactPattern)
+
+		if err != nil {
+			fatal("Invalid -redact-pattern: " + err.Error())
+		}
+
+		redactRegexp = pattern
+	}
+
 	// Verify that the correct number of args were supplied
-	if len(region) == 0 || len(secretArn) == 0 {
+	if len(region) == 0 || (len(secretArn) == 0 && len(arnParameter) == 0 && !whoami) {
 		flag.PrintDefaults()
-		panic("You must supply a region and secret ARN.  -r REGION -s SECRET-ARN [-a ARN for ROLE -t TIMEOUT IN MILLISECONDS -n SESSION NAME]")
+		fatal("You must supply a region and secret ARN.  -r REGION -s SECRET-ARN [-a ARN for ROLE -t TIMEOUT IN MILLISECONDS -n SESSION NAME] [-- COMMAND ARGS...]")
+	}
+
+	// The secret ARN is either supplied directly or read from SSM, but not both
+	if len(secretArn) > 0 && len(arnParameter) > 0 {
+		fatal("-s and -arn-from-ssm cannot be used together")
+	}
+
+	// An absolute deadline replaces the relative timeout, so only one of them may be supplied
+	if len(deadline) > 0 {
+		flag.Visit(func(f *flag.Flag) {
+			if f.Name == "t" {
+				fatal("-t and -deadline cannot be used together")
+			}
+		})
+
+		parsed, err := time.Parse(time.RFC3339, deadline)
+
+		if err != nil {
+			fatal("Invalid -deadline " + deadline + ".  The deadline must be an RFC3339 timestamp")
+		}
+
+		deadlineTime = parsed
+	}
+
+	// An SSO role is identified by the session, account and role together
+	if (len(ssoSession) > 0 || len(ssoAccount) > 0 || len(ssoRole) > 0) && (len(ssoSession) == 0 || len(ssoAccount) == 0 || len(ssoRole) == 0) {
+		fatal("-sso-session, -sso-account and -sso-role must be supplied together")
+	}
+
+	// Reject a malformed glob before any API calls are made
+	if _, err := path.Match(keyGlob, ""); err != nil {
+		fatal("Invalid -glob " + keyGlob + ": " + err.Error())
+	}
+
+	// Every call is attempted at least once
+	if maxAttempts < 1 {
+		fatal("-max-attempts must be at least 1")
+	}
+
+	// Verify that the parse format is one that is supported
+	if len(parseFormat) > 0 && parseFormat != PARSE_PROPERTIES {
+		fatal("Unsupported -parse format " + parseFormat + ".  Supported formats are: " + PARSE_PROPERTIES)
+	}
+
+	// Verify that the output format is one that is supported
+	if _, ok := formatters[outputFormat]; !ok {
+		fatal("Unsupported -o format " + outputFormat + ".  Supported formats are: " + strings.Join(OutputFormats(), ", "))
+	}
+
+	// The key/value separators may be supplied with escape sequences that need to be expanded
+	if outputFormat == OUTPUT_KEYVALUE {
+		var err error
+
+		if kvSeparator, err = unescapeSeparator(kvSeparator); err != nil {
+			fatal("Invalid -kv-sep: " + err.Error())
+		}
+
+		if lineSeparator, err = unescapeSeparator(lineSeparator); err != nil {
+			fatal("Invalid -line-sep: " + err.Error())
+		}
+
+		if len(kvSeparator) == 0 || len(lineSeparator) == 0 {
+			fatal("-kv-sep and -line-sep cannot be empty")
+		}
+	}
+
+	// Values are quoted in one of the supported styles
+	if quoteStyle != QUOTE_NONE && quoteStyle != QUOTE_SINGLE && quoteStyle != QUOTE_DOUBLE && quoteStyle != QUOTE_AUTO {
+		fatal("Invalid -quote-style " + quoteStyle + ".  The value must be none, single, double or auto")
+	}
+
+	// Newlines can only be converted in one direction
+	if normalizeNewlines && escapeNewlines {
+		fatal("-normalize-newlines and -escape-newlines cannot be used together")
+	}
+
+	// There is only a single output file
+	if len(outFile) > 0 && len(secureOutFile) > 0 {
+		fatal("-out and -secure-out cannot be used together")
+	}
+
+	// Overflow keys are only moved when there is a budget to fit
+	if len(overflowOutFile) > 0 && fitBudget <= 0 {
+		fatal("-overflow-out requires -fit-budget")
+	}
+
+	// Attempt timeouts grow in one of the supported ways, and only when there is a timeout to grow
+	if timeoutEscalation != ESCALATION_NONE && timeoutEscalation != ESCALATION_LINEAR && timeoutEscalation != ESCALATION_EXPONENTIAL {
+		fatal("Invalid -timeout-retry-escalation " + timeoutEscalation + ".  The value must be none, linear or exponential")
+	}
+
+	if attemptTimeout < 0 || (timeoutEscalation != ESCALATION_NONE && attemptTimeout == 0) {
+		fatal("-timeout-retry-escalation requires a positive -attempt-timeout")
+	}
+
+	// Keys are sorted by their name or the length of their value
+	if sortBy != SORT_BY_NAME && sortBy != SORT_BY_VALUE_LENGTH {
+		fatal("Invalid -sort-by " + sortBy + ".  The value must be name or value-length")
+	}
+
+	// Each default must name the key it is for
+	for _, entry := range defaultKeys {
+		if parts := strings.SplitN(entry, "=", 2); len(parts) != 2 || len(parts[0]) == 0 {
+			fatal("Invalid -default-key " + entry + ".  The value must be KEY=DEFAULT")
+		}
+	}
+
+	// Only the arguments after a literal -- are a command to run.  Any other argument is a mistake,
+	// such as a flag value that was not quoted, and must not be executed.
+	if args := flag.Args(); len(args) > 0 {
+		if os.Args[len(os.Args)-len(args)-1] != "--" {
+			fatal("Unexpected argument " + args[0] + ".  A command to run must follow --")
+		}
+
+		command = args
+	}
+
+	// The command replaces any other output, so it cannot be combined with options that print or write
+	// something else and would otherwise silently skip running it
+	if len(command) > 0 && (describe || whoami || len(desiredStateFile) > 0 || len(outFile) > 0 || len(secureOutFile) > 0) {
+		fatal("A command after -- cannot be used with -describe, -whoami, -desired-state, -out or -secure-out")
+	}
+
+	// Nothing is output or executed when only validating
+	if validateOnly && (len(outFile) > 0 || len(secureOutFile) > 0 || len(overflowOutFile) > 0 || len(command) > 0) {
+		fatal("-validate-only cannot be used with -out, -secure-out, -overflow-out or a command")
+	}
+
+	// The final newline is either forced on or off
+	if len(finalNewline) > 0 && finalNewline != "true" && finalNewline != "false" {
+		fatal("Invalid -final-newline " + finalNewline + ".  The value must be true or false")
+	}
+
+	// The checksum sidecar is only written next to an output file
+	if writeChecksum && len(outFile) == 0 && len(secureOutFile) == 0 {
+		fatal("-write-checksum requires -out or -secure-out")
+	}
+
+	// The segments of a KV path need something to separate them
+	if len(kvPathSeparator) == 0 {
+		fatal("-kv-path-sep cannot be empty")
+	}
+
+	// The bundle is assigned to a variable that must be a valid identifier
+	if len(bundleVar) > 0 && !bashIdentifierPattern.MatchString(bundleVar) {
+		fatal("Invalid -bundle-var " + bundleVar + ".  The name must be a valid environment variable name")
+	}
+
+	// The array name must be a valid Bash identifier
+	if outputFormat == OUTPUT_BASH_ASSOC && !bashIdentifierPattern.MatchString(arrayName) {
+		fatal("Invalid -array-name " + arrayName + ".  The name must be a valid Bash identifier")
+	}
+}
+
+// This function will convert the secret string into a map of keys to values.  Secrets that are not
+// JSON are parsed using the -parse format when one was supplied.
+func ParseSecret(secretString string) (map[string]interface{}, error) {
+	var dat map[string]interface{}
+
+	if err := json.Unmarshal([]byte(secretString), &dat); err != nil {
+		// The secret is not JSON, fall back to the format requested with -parse if there is one
+		if parseFormat == PARSE_PROPERTIES {
+			logVerbose("Secret is not JSON, parsing it as Java properties")
+			return ParseProperties(secretString)
+		}
+
+		return nil, err
+	}
+
+	return dat, nil
+}
+
+// This function will make the call and, while it fails, switch to each -fallback-secret in turn, along
+// with its region, and make the call again
+func withFallback(cfg *aws.Config, action string, call func() error) error {
+	err := call()
+
+	for next := 0; err != nil && next < len(fallbackSecrets); next++ {
+		logWarning("Failed to %s secret %s due to error %s, falling back to secret %s", action, secretArn, err.Error(), fallbackSecrets[next])
+
+		secretArn = fallbackSecrets[next]
+		cfg.Region = fallbackRegion(next)
+		err = call()
+
+		if err == nil {
+			logWarning("Using fallback secret %s in region %s", secretArn, cfg.Region)
+		}
+	}
+
+	return err
+}
+
+// This function will return the region to use for the fallback secret at the index.  This is the
+// matching -fallback-region when one was supplied, otherwise the region from the secret ARN, or -r
+// when the fallback is not an ARN.
+func fallbackRegion(index int) string {
+	if index < len(fallbackRegions) {
+		return fallbackRegions[index]
+	}
+
+	if parts := strings.Split(fallbackSecrets[index], ":"); len(parts) > 3 && parts[0] == "arn" && len(parts[3]) > 0 {
+		return parts[3]
+	}
+
+	return region
+}
+
+// This function will sleep for a random duration of up to -startup-jitter milliseconds, returning early
+// with an error if the context ends first
+func StartupJitter(ctx context.Context) error {
+	if startupJitter <= 0 {
+		return nil
+	}
+
+	delay := time.Duration(rand.New(rand.NewSource(time.Now().UnixNano())).Int63n(int64(startupJitter)+1)) * time.Millisecond
+	logVerbose("Delaying startup by %v", delay)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 }
 
@@ -113,32 +749,124 @@ func AttemptAssumeRole(ctx context.Context, cfg aws.Config) (*sts.AssumeRoleOutp
 		return nil, nil
 	}
 
+	// Reuse the credentials from a previous run while they are still valid
+	if !noCredCache {
+		if cached := readCachedRole(); cached != nil {
+			return cached, nil
+		}
+	}
+
 	client := sts.NewFromConfig(cfg)
 
-	return client.AssumeRole(ctx,
-		&sts.AssumeRoleInput{
-			RoleArn:         &roleArn,
-			RoleSessionName: &sessionName,
-		},
-	)
+	// STS throttles under mass assume-role, so the call is retried with backoff up to -max-attempts
+	var result *sts.AssumeRoleOutput
+	err := newRetrier("STS AssumeRole").Do(ctx, func(ctx context.Context) error {
+		var err error
+
+		result, err = client.AssumeRole(ctx,
+			&sts.AssumeRoleInput{
+				RoleArn:         &roleArn,
+				RoleSessionName: &sessionName,
+			},
+		)
+
+		return err
+	})
+
+	if err == nil && !noCredCache {
+		writeCachedRole(result)
+	}
+
+	return result, err
+}
+
+// This function will return a description of the identity that API calls are made as when using the
+// supplied assumed role
+func GetCallerIdentity(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) (string, error) {
+	client := sts.NewFromConfig(RoleConfig(cfg, assumedRole))
+
+	identity, err := client.GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Account: %s  ARN: %s  UserId: %s", aws.ToString(identity.Account), aws.ToString(identity.Arn), aws.ToString(identity.UserId)), nil
+}
+
+// This function will return a copy of the config that uses the credentials of the assumed role, or
+// the config itself when no role was assumed
+func RoleConfig(cfg aws.Config, assumedRole *sts.AssumeRoleOutput) aws.Config {
+	if assumedRole == nil {
+		return cfg
+	}
+
+	roleCfg := cfg.Copy()
+	roleCfg.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(*assumedRole.Credentials.AccessKeyId, *assumedRole.Credentials.SecretAccessKey, *assumedRole.Credentials.SessionToken))
+
+	return roleCfg
 }
 
 // This function will return the descrypted version of the Secret from Secret Manager using the supplied
 // assumed role to interact with Secret Manager.  This function will return either an error or the
 // retrieved and decrypted secret.
 func GetSecret(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) (*secretsmanager.GetSecretValueOutput, error) {
+	return GetSecretVersion(ctx, cfg, assumedRole, "")
+}
 
-	if assumedRole != nil {
-		client := secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
-			o.Credentials = aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(*assumedRole.Credentials.AccessKeyId, *assumedRole.Credentials.SecretAccessKey, *assumedRole.Credentials.SessionToken))
-		})
-		return client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-			SecretId: aws.String(secretArn),
-		})
-	} else {
-		client := secretsmanager.NewFromConfig(cfg)
-		return client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
-			SecretId: aws.String(secretArn),
-		})
+// This function will return the decrypted Secret in the same way as GetSecret, but for the supplied
+// version ID.  An empty version ID retrieves the current version.
+func GetSecretVersion(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput, versionId string) (*secretsmanager.GetSecretValueOutput, error) {
+	client := secretsmanager.NewFromConfig(RoleConfig(cfg, assumedRole))
+
+	input := &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretArn),
+	}
+
+	if len(versionId) > 0 {
+		input.VersionId = aws.String(versionId)
 	}
+
+	// Retried in the same way as STS AssumeRole so that -attempt-timeout also covers a slow retrieval
+	var result *secretsmanager.GetSecretValueOutput
+	err := newRetrier("Secrets Manager GetSecretValue").Do(ctx, func(ctx context.Context) error {
+		var err error
+		result, err = client.GetSecretValue(ctx, input)
+		return err
+	})
+
+	// A decryption failure is almost always caused by the KMS key, so explain that rather than
+	// only reporting the raw error
+	var decryptionFailure *types.DecryptionFailure
+	if errors.As(err, &decryptionFailure) {
+		return nil, kmsGuidance(ctx, cfg, assumedRole, err)
+	}
+
+	return result, err
+}
+
+// This function will return the metadata of the Secret from Secret Manager using the supplied assumed
+// role.  No secret value is retrieved.
+func DescribeSecret(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) (*secretsmanager.DescribeSecretOutput, error) {
+	client := secretsmanager.NewFromConfig(RoleConfig(cfg, assumedRole))
+
+	return client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secretArn),
+	})
+}
+
+// This function will wrap a DecryptionFailure with the likely KMS causes, naming the KMS key used by
+// the secret when DescribeSecret is permitted
+func kmsGuidance(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput, err error) error {
+	key := "the KMS key of the secret"
+
+	if description, describeErr := DescribeSecret(ctx, cfg, assumedRole); describeErr == nil {
+		if description.KmsKeyId != nil {
+			key = "KMS key " + *description.KmsKeyId
+		} else {
+			key = "the AWS managed key aws/secretsmanager"
+		}
+	}
+
+	return fmt.Errorf("%w.  Secrets Manager could not decrypt the secret with %s.  Verify that the key is enabled and not pending deletion, and that the caller is allowed kms:Decrypt on the key by both its IAM policy and the key policy", err, key)
 }
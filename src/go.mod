@@ -1,4 +1,4 @@
-// 
+//
 // Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
 // SPDX-License-Identifier: MIT-0
 //
@@ -9,9 +9,11 @@ go 1.15
 require (
 	github.com/aws/aws-sdk-go v1.40.35 // indirect
 	github.com/aws/aws-sdk-go-v2 v1.9.0
-	github.com/aws/aws-sdk-go-v2/config v1.7.0 // indirect
-	github.com/aws/aws-sdk-go-v2/credentials v1.4.0 // indirect
-	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.6.0 // indirect
-	github.com/aws/aws-sdk-go-v2/service/ssm v1.10.0 // indirect
-	github.com/aws/aws-sdk-go-v2/service/sts v1.7.0 // indirect
+	github.com/aws/aws-sdk-go-v2/config v1.7.0
+	github.com/aws/aws-sdk-go-v2/credentials v1.4.0
+	github.com/aws/aws-sdk-go-v2/service/secretsmanager v1.6.0
+	github.com/aws/aws-sdk-go-v2/service/ssm v1.10.0
+	github.com/aws/aws-sdk-go-v2/service/sso v1.4.0
+	github.com/aws/aws-sdk-go-v2/service/sts v1.7.0
+	github.com/aws/smithy-go v1.8.0
 )
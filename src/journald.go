@@ -0,0 +1,72 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code records that a secret was loaded in the systemd journal using the journald native
+// protocol.  Only the names of the keys are logged, never their values.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// The socket journald listens on for native protocol messages
+const JOURNALD_SOCKET = "/run/systemd/journal/socket"
+
+// The syslog priority of the message, informational
+const JOURNALD_PRIORITY = 6
+
+// This function will send a structured message to the journal confirming which keys were loaded from
+// the secret.  When the journal is unavailable the message is written to stderr instead.
+func LogLoadedToJournal(keys []string) {
+	message := redact(fmt.Sprintf("Loaded %d keys from secret %s", len(keys), secretArn))
+
+	fields := [][2]string{
+		{"MESSAGE", message},
+		{"PRIORITY", strconv.Itoa(JOURNALD_PRIORITY)},
+		{"SYSLOG_IDENTIFIER", filepath.Base(os.Args[0])},
+		{"SECRET_ARN", redact(secretArn)},
+		{"SECRET_KEY_COUNT", strconv.Itoa(len(keys))},
+		{"SECRET_KEYS", redact(strings.Join(keys, ","))},
+	}
+
+	if err := sendToJournal(fields); err != nil {
+		logVerbose("The journal is unavailable (%s), logging to stderr", err.Error())
+		fmt.Fprintln(os.Stderr, message+": "+redact(strings.Join(keys, ", ")))
+	}
+}
+
+// This function will send the fields as a single journald native protocol datagram.  Values containing
+// a newline use the binary form of NAME, newline, little endian 64 bit length, then the value.
+func sendToJournal(fields [][2]string) error {
+	conn, err := net.Dial("unixgram", JOURNALD_SOCKET)
+
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var datagram bytes.Buffer
+	for _, field := range fields {
+		if !strings.Contains(field[1], "\n") {
+			datagram.WriteString(field[0] + "=" + field[1] + "\n")
+			continue
+		}
+
+		datagram.WriteString(field[0] + "\n")
+		binary.Write(&datagram, binary.LittleEndian, uint64(len(field[1])))
+		datagram.WriteString(field[1] + "\n")
+	}
+
+	_, err = conn.Write(datagram.Bytes())
+
+	return err
+}
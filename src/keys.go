@@ -0,0 +1,273 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code determines which keys of the secret are output and in which order, and reads the
+// supporting files that describe the keys.
+//
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// This function will return a map seeded from the process environment with the secret values layered
+// on top, so that a value from the secret always wins over the environment
+func MergeOSEnv(dat map[string]interface{}) map[string]interface{} {
+	merged := map[string]interface{}{}
+
+	for _, entry := range os.Environ() {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if len(parts) == 2 && len(parts[0]) > 0 {
+			merged[parts[0]] = parts[1]
+		}
+	}
+
+	for key, value := range dat {
+		merged[key] = value
+	}
+
+	return merged
+}
+
+// This function will add the -default-key values for any keys that are missing.  Values that are
+// already present always win over the defaults.  When only is not nil, just the defaults for the keys
+// in it are added.
+func ApplyDefaults(dat map[string]interface{}, only map[string]bool) map[string]interface{} {
+	for _, entry := range defaultKeys {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if _, ok := dat[parts[0]]; ok || (only != nil && !only[parts[0]]) {
+			continue
+		}
+
+		logVerbose("Key %s is missing from the secret, using its -default-key value", parts[0])
+		dat[parts[0]] = parts[1]
+	}
+
+	return dat
+}
+
+// This function will return the keys that are missing from the current secret and whose -default-key
+// value differs from the value in the previous version, which are the defaults that changed
+func ChangedDefaults(current map[string]interface{}, previous map[string]interface{}) map[string]bool {
+	changed := map[string]bool{}
+
+	for _, entry := range defaultKeys {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if _, ok := current[parts[0]]; ok {
+			continue
+		}
+
+		if old, ok := previous[parts[0]]; ok && !reflect.DeepEqual(old, parts[1]) {
+			changed[parts[0]] = true
+		}
+	}
+
+	return changed
+}
+
+// This function will return the values of the current secret that are new or different from the
+// values of the previous version of the secret
+func ChangedValues(current map[string]interface{}, previous map[string]interface{}) map[string]interface{} {
+	changed := map[string]interface{}{}
+
+	for key, value := range current {
+		if old, ok := previous[key]; !ok || !reflect.DeepEqual(old, value) {
+			changed[key] = value
+		}
+	}
+
+	logVerbose("%d of %d keys changed since the previous version", len(changed), len(current))
+
+	return changed
+}
+
+// This function will return only the values whose keys match the -glob pattern, using path.Match semantics
+func FilterGlob(dat map[string]interface{}) map[string]interface{} {
+	filtered := map[string]interface{}{}
+
+	for key, value := range dat {
+		if matched, _ := path.Match(keyGlob, key); matched {
+			filtered[key] = value
+		}
+	}
+
+	if len(filtered) == 0 {
+		logVerbose("The -glob pattern %s did not match any keys", keyGlob)
+	}
+
+	return filtered
+}
+
+// This function will return the keys of the secret in the order they should be output.  Keys
+// listed in the -key-order file are returned first in the order they appear in the file, followed
+// by any remaining keys sorted by -sort-by.
+func OrderKeys(dat map[string]interface{}) ([]string, error) {
+	ordered := []string{}
+	seen := map[string]bool{}
+
+	if len(keyOrderFile) > 0 {
+		listed, err := readLinesFile(keyOrderFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range listed {
+			if seen[key] {
+				continue
+			}
+
+			if _, ok := dat[key]; !ok {
+				logVerbose("Key %s from %s is not present in the secret, skipping", key, keyOrderFile)
+				continue
+			}
+
+			seen[key] = true
+			ordered = append(ordered, key)
+		}
+	}
+
+	remaining := []string{}
+	for key := range dat {
+		if !seen[key] {
+			remaining = append(remaining, key)
+		}
+	}
+	sort.Slice(remaining, keyComparator(remaining, dat))
+
+	return append(ordered, remaining...), nil
+}
+
+// This function will return the comparator for sorting the keys according to -sort-by and
+// -sort-desc.  Keys with values of the same length are sorted by name so the order is always
+// deterministic.
+func keyComparator(keys []string, dat map[string]interface{}) func(i, j int) bool {
+	less := func(i, j int) bool {
+		if sortBy == SORT_BY_VALUE_LENGTH {
+			left, right := len(valueString(dat[keys[i]])), len(valueString(dat[keys[j]]))
+
+			if left != right {
+				return left < right
+			}
+		}
+
+		return keys[i] < keys[j]
+	}
+
+	if sortDesc {
+		return func(i, j int) bool {
+			return less(j, i)
+		}
+	}
+
+	return less
+}
+
+// This function will split the keys into those that fit within -fit-budget bytes and those that
+// overflow.  The smallest keys are kept first so that as many keys as possible stay inline, and each
+// key is counted as the length of its name plus the length of its value, which is how Lambda measures
+// its environment variables.  Both lists preserve the original key order.
+func FitBudget(keys []string, dat map[string]interface{}) ([]string, []string) {
+	sizes := map[string]int{}
+	bySize := append([]string{}, keys...)
+
+	for _, key := range keys {
+		sizes[key] = len(key) + len(valueString(dat[key]))
+	}
+	sort.SliceStable(bySize, func(i, j int) bool { return sizes[bySize[i]] < sizes[bySize[j]] })
+
+	fits := map[string]bool{}
+	total := 0
+	for _, key := range bySize {
+		if total+sizes[key] > fitBudget {
+			break
+		}
+
+		total += sizes[key]
+		fits[key] = true
+	}
+
+	inline := []string{}
+	overflow := []string{}
+	overflowBytes := 0
+	for _, key := range keys {
+		if fits[key] {
+			inline = append(inline, key)
+		} else {
+			overflow = append(overflow, key)
+			overflowBytes += sizes[key]
+		}
+	}
+
+	if len(overflow) == 0 {
+		logVerbose("All %d keys fit within the budget of %d bytes using %d bytes", len(keys), fitBudget, total)
+	} else {
+		logWarning("%d keys using %d bytes fit within the budget of %d bytes, %d keys using %d bytes do not: %s", len(inline), total, fitBudget, len(overflow), overflowBytes, strings.Join(overflow, ", "))
+	}
+
+	return inline, overflow
+}
+
+// This function will read the non-blank lines of a file such as the key order file, skipping lines
+// starting with # as comments.
+func readLinesFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := []string{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keys = append(keys, line)
+	}
+
+	return keys, scanner.Err()
+}
+
+// This function will read the comments file.  Each non-blank line holds KEY=description, and lines
+// starting with # are treated as comments.
+func ReadCommentsFile(path string) (map[string]string, error) {
+	return readAssignmentsFile(path, "description")
+}
+
+// This function will read a file of KEY=VALUE lines into a map, skipping blank lines and lines starting
+// with #.  The name of the value is used in the error for malformed lines.
+func readAssignmentsFile(path string, valueName string) (map[string]string, error) {
+	lines, err := readLinesFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := map[string]string{}
+	for _, line := range lines {
+		parts := strings.SplitN(line, "=", 2)
+
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid line %q, expected KEY=%s", line, valueName)
+		}
+
+		assignments[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+
+	return assignments, nil
+}
@@ -0,0 +1,162 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// Tests for the key selection and default handling
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestApplyDefaults(t *testing.T) {
+	defer func(defaults stringList) { defaultKeys = defaults }(defaultKeys)
+	defaultKeys = stringList{"A=default", "B=default", "C=x=y"}
+
+	tests := []struct {
+		name     string
+		dat      map[string]interface{}
+		only     map[string]bool
+		expected map[string]interface{}
+	}{
+		{"missing keys", map[string]interface{}{"A": "secret", "D": "secret"}, nil, map[string]interface{}{"A": "secret", "B": "default", "C": "x=y", "D": "secret"}},
+		{"empty value wins", map[string]interface{}{"A": ""}, nil, map[string]interface{}{"A": "", "B": "default", "C": "x=y"}},
+		{"only listed keys", map[string]interface{}{}, map[string]bool{"B": true}, map[string]interface{}{"B": "default"}},
+		{"no listed keys", map[string]interface{}{}, map[string]bool{}, map[string]interface{}{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if dat := ApplyDefaults(test.dat, test.only); !reflect.DeepEqual(dat, test.expected) {
+				t.Errorf("got %v, expected %v", dat, test.expected)
+			}
+		})
+	}
+}
+
+func TestApplyDefaultsWithChangedSinceVersion(t *testing.T) {
+	defer func(defaults stringList) { defaultKeys = defaults }(defaultKeys)
+	defaultKeys = stringList{"UNCHANGED=default", "CHANGED=default", "ADDED=default", "MISSING=default", "REMOVED=default", "RESTORED=default"}
+
+	current := map[string]interface{}{"UNCHANGED": "same", "CHANGED": "new", "ADDED": "new"}
+	previous := map[string]interface{}{"UNCHANGED": "same", "CHANGED": "old", "REMOVED": "old", "RESTORED": "default"}
+
+	// The same steps as main: the defaults that changed are found before the unchanged keys are dropped
+	changedDefaults := ChangedDefaults(current, previous)
+	dat := ApplyDefaults(ChangedValues(current, previous), changedDefaults)
+	expected := map[string]interface{}{"CHANGED": "new", "ADDED": "new", "REMOVED": "default"}
+
+	if !reflect.DeepEqual(dat, expected) {
+		t.Errorf("got %v, expected %v", dat, expected)
+	}
+}
+
+func TestApplyDefaultsWithOSEnv(t *testing.T) {
+	defer func(defaults stringList) { defaultKeys = defaults }(defaultKeys)
+	defaultKeys = stringList{"GRS_TEST_SET=default", "GRS_TEST_UNSET=default"}
+
+	os.Setenv("GRS_TEST_SET", "environment")
+	defer os.Unsetenv("GRS_TEST_SET")
+	os.Unsetenv("GRS_TEST_UNSET")
+
+	dat := ApplyDefaults(MergeOSEnv(map[string]interface{}{}), nil)
+
+	if dat["GRS_TEST_SET"] != "environment" || dat["GRS_TEST_UNSET"] != "default" {
+		t.Errorf("got GRS_TEST_SET=%v and GRS_TEST_UNSET=%v, expected the environment to win over defaults", dat["GRS_TEST_SET"], dat["GRS_TEST_UNSET"])
+	}
+}
+
+func TestDesiredStateOperations(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  map[string]interface{}
+		desired  map[string]interface{}
+		expected []stateOperation
+	}{
+		{"identical", map[string]interface{}{"A": "1"}, map[string]interface{}{"A": "1"}, []stateOperation{}},
+		{"both empty", map[string]interface{}{}, map[string]interface{}{}, []stateOperation{}},
+		{"add", map[string]interface{}{"A": "1"}, map[string]interface{}{"A": "1", "LOG_LEVEL": "info"}, []stateOperation{{OPERATION_ADD, "LOG_LEVEL"}}},
+		{"delete", map[string]interface{}{"A": "1", "B": "2"}, map[string]interface{}{"A": "1"}, []stateOperation{{OPERATION_DELETE, "B"}}},
+		{"update", map[string]interface{}{"A": "1"}, map[string]interface{}{"A": "2"}, []stateOperation{{OPERATION_UPDATE, "A"}}},
+		{"type change is an update", map[string]interface{}{"A": "1"}, map[string]interface{}{"A": 1.0}, []stateOperation{{OPERATION_UPDATE, "A"}}},
+		{"nested values", map[string]interface{}{"A": map[string]interface{}{"x": "1"}}, map[string]interface{}{"A": map[string]interface{}{"x": "1"}}, []stateOperation{}},
+		{"sorted by key", map[string]interface{}{"C": "1", "B": "1"}, map[string]interface{}{"B": "2", "A": "1"},
+			[]stateOperation{{OPERATION_ADD, "A"}, {OPERATION_UPDATE, "B"}, {OPERATION_DELETE, "C"}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if operations := DesiredStateOperations(test.current, test.desired); !reflect.DeepEqual(operations, test.expected) {
+				t.Errorf("got %v, expected %v", operations, test.expected)
+			}
+		})
+	}
+}
+
+func TestDesiredStateIgnoresDefaults(t *testing.T) {
+	defer func(defaults stringList) { defaultKeys = defaults }(defaultKeys)
+	defaultKeys = stringList{"LOG_LEVEL=info"}
+
+	file, err := ioutil.TempFile("", "desired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.WriteString(`{"A": "1", "LOG_LEVEL": "info"}`); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// A key that only has a default is not part of the secret, so the desired state must add it
+	var output bytes.Buffer
+	if err := PrintDesiredStateOperations(file.Name(), map[string]interface{}{"A": "1"}, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	var operations []stateOperation
+	if err := json.Unmarshal(output.Bytes(), &operations); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []stateOperation{{OPERATION_ADD, "LOG_LEVEL"}}; !reflect.DeepEqual(operations, expected) {
+		t.Errorf("got %v, expected %v", operations, expected)
+	}
+}
+
+func TestFitBudget(t *testing.T) {
+	defer func(budget int) { fitBudget = budget }(fitBudget)
+
+	dat := map[string]interface{}{"A": "1234", "BB": "1", "C": "123456789", "D": 12.0}
+	keys := []string{"A", "BB", "C", "D"}
+
+	tests := []struct {
+		name     string
+		budget   int
+		inline   []string
+		overflow []string
+	}{
+		{"everything fits", 100, []string{"A", "BB", "C", "D"}, []string{}},
+		{"exact fit", 21, []string{"A", "BB", "C", "D"}, []string{}},
+		{"smallest kept first in original order", 8, []string{"BB", "D"}, []string{"A", "C"}},
+		{"largest overflows", 17, []string{"A", "BB", "D"}, []string{"C"}},
+		{"nothing fits", 1, []string{}, []string{"A", "BB", "C", "D"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fitBudget = test.budget
+			inline, overflow := FitBudget(keys, dat)
+
+			if !reflect.DeepEqual(inline, test.inline) || !reflect.DeepEqual(overflow, test.overflow) {
+				t.Errorf("got %v and %v, expected %v and %v", inline, overflow, test.inline, test.overflow)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// Logging helpers.  All log output is written to stderr so that it never mixes with the
+// secret values written to stdout, and passes through the -redact-pattern scrubbing.
+//
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// The compiled -redact-pattern, or nil when no pattern was supplied
+var redactRegexp *regexp.Regexp
+
+// This function will replace any substring matching -redact-pattern with ***
+func redact(message string) string {
+	if redactRegexp == nil {
+		return message
+	}
+
+	return redactRegexp.ReplaceAllString(message, "***")
+}
+
+// This function will write a diagnostic message to stderr when -verbose is enabled
+func logVerbose(format string, args ...interface{}) {
+	if !verbose {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, redact(fmt.Sprintf(format, args...)))
+}
+
+// This function will write a warning to stderr regardless of -verbose
+func logWarning(format string, args ...interface{}) {
+	fmt.Fprintln(os.Stderr, redact("WARNING: "+fmt.Sprintf(format, args...)))
+}
+
+// This function will abort execution with the supplied message after it has been redacted
+func fatal(message string) {
+	panic(redact(message))
+}
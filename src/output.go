@@ -0,0 +1,661 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code contains the formatters used to write the retrieved secret to the output.  Each
+// formatter receives the keys in the order they should be written along with the secret values.
+//
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf16"
+)
+
+// Supported values for -o
+const OUTPUT_PIPE = "pipe"
+const OUTPUT_BASH_ASSOC = "bash-assoc"
+const OUTPUT_DOTENV = "dotenv"
+const OUTPUT_PROPERTIES = "properties"
+const OUTPUT_KEYVALUE = "keyvalue"
+const OUTPUT_COLON = "colon"
+const OUTPUT_JS_MODULE = "js-module"
+const OUTPUT_PHP_ARRAY = "php-array"
+const OUTPUT_NETRC = "netrc"
+const OUTPUT_ENV_BUNDLE = "env-bundle"
+const OUTPUT_KV_PATHS = "kv-paths"
+const OUTPUT_KV_JSON = "kv-json"
+
+// Supported values for -quote-style
+const QUOTE_NONE = "none"
+const QUOTE_SINGLE = "single"
+const QUOTE_DOUBLE = "double"
+const QUOTE_AUTO = "auto"
+
+// A formatter writes the values for the supplied keys to the writer
+type formatter func(w io.Writer, keys []string, dat map[string]interface{}) error
+
+var formatters = map[string]formatter{
+	OUTPUT_PIPE:       writePipe,
+	OUTPUT_BASH_ASSOC: writeBashAssoc,
+	OUTPUT_DOTENV:     writeDotenv,
+	OUTPUT_PROPERTIES: writeProperties,
+	OUTPUT_KEYVALUE:   writeKeyValue,
+	OUTPUT_COLON:      writeColon,
+	OUTPUT_JS_MODULE:  writeJSModule,
+	OUTPUT_PHP_ARRAY:  writePHPArray,
+	OUTPUT_NETRC:      writeNetrc,
+	OUTPUT_ENV_BUNDLE: writeEnvBundle,
+	OUTPUT_KV_PATHS:   writeKVPaths,
+	OUTPUT_KV_JSON:    writeKVJSON,
+}
+
+// The descriptions of keys read from -comments-file
+var keyComments map[string]string
+
+// Characters that can appear in a dotenv value without quoting
+var dotenvSafePattern = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]+$`)
+
+// The plain scalars that YAML readers treat as booleans, nulls or special numbers
+var yamlKeywords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true, "y": true, "n": true,
+	"null": true, "~": true, ".inf": true, "+.inf": true, "-.inf": true, ".nan": true,
+}
+
+// A valid Bash variable name
+var bashIdentifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// This function will return the names of the supported output formats in sorted order
+func OutputFormats() []string {
+	names := []string{}
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// This function will write the secret to the writer using the format selected with -o.  When
+// -final-newline is set, the output is made to end, or not end, with a newline.
+func WriteOutput(w io.Writer, keys []string, dat map[string]interface{}) error {
+	if len(finalNewline) == 0 {
+		return formatters[outputFormat](w, keys, dat)
+	}
+
+	var output bytes.Buffer
+	if err := formatters[outputFormat](&output, keys, dat); err != nil {
+		return err
+	}
+
+	content := output.Bytes()
+	if finalNewline == "false" {
+		content = bytes.TrimSuffix(bytes.TrimSuffix(content, []byte("\n")), []byte("\r"))
+	} else if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+		content = append(content, '\n')
+	}
+
+	_, err := w.Write(content)
+
+	return err
+}
+
+// This function will write the output to the file with permissions that only allow the owner to read
+// it.  When -write-checksum is set, the SHA-256 of the exact bytes written is stored in FILE.sha256 in
+// the format read by sha256sum -c.  With noFollow, which is used for -secure-out, neither file is
+// written through a symbolic link.
+func WriteOutputFile(path string, output []byte, noFollow bool) error {
+	flags := 0
+	if noFollow {
+		flags = syscall.O_NOFOLLOW
+	}
+
+	if err := writePrivateFileFlags(path, output, flags); err != nil {
+		return err
+	}
+
+	if !writeChecksum {
+		return nil
+	}
+
+	sum := sha256.Sum256(output)
+	checksum := fmt.Sprintf("%s  %s\n", hex.EncodeToString(sum[:]), filepath.Base(path))
+
+	return writePrivateFileFlags(path+".sha256", []byte(checksum), flags)
+}
+
+// This function will write the data to the file and make sure that it has 0600 permissions, even if
+// the file already existed with broader permissions
+func writePrivateFile(path string, data []byte) error {
+	return writePrivateFileFlags(path, data, 0)
+}
+
+// This function will write the data to the file as writePrivateFile does, opening it with the
+// additional flags
+func writePrivateFileFlags(path string, data []byte, flags int) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC|flags, 0600)
+
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Restrict an existing file before any of the data is written to it
+	if err := file.Chmod(0600); err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data); err != nil {
+		return err
+	}
+
+	return file.Close()
+}
+
+// This function will convert a secret value into the string that is output.  Strings are output
+// as is, while any other JSON value is output as its JSON encoding.
+func valueString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+
+	encoded, err := json.Marshal(value)
+
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+
+	return string(encoded)
+}
+
+// This function will write each key and value as KEY|VALUE, the format read by get-secrets-layer
+func writePipe(w io.Writer, keys []string, dat map[string]interface{}) error {
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "%s|%s\n", key, dat[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will write the secret as a single Bash associative array declaration named by
+// -array-name, for example declare -A SECRETS=( ["KEY"]="value" )
+func writeBashAssoc(w io.Writer, keys []string, dat map[string]interface{}) error {
+	if _, err := fmt.Fprintf(w, "declare -A %s=(\n", arrayName); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "  [%s]=%s\n", bashDoubleQuote(key), bashDoubleQuote(valueString(dat[key]))); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, ")")
+
+	return err
+}
+
+// This function will quote the string for use inside Bash double quotes, escaping the characters
+// that would otherwise be expanded
+func bashDoubleQuote(s string) string {
+	var b strings.Builder
+
+	b.WriteByte('"')
+	for _, r := range s {
+		if strings.ContainsRune("\"\\$`", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	b.WriteByte('"')
+
+	return b.String()
+}
+
+// This function will write each key and value as a KEY=VALUE line of a .env file, quoting the
+// value when it contains characters that are not safe to use bare
+func writeDotenv(w io.Writer, keys []string, dat map[string]interface{}) error {
+	for _, key := range keys {
+		if err := writeComment(w, key); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", key, styleQuote(valueString(dat[key]), dotenvQuote, singleQuote, dotenvDoubleQuote)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will quote a dotenv value with double quotes when needed
+func dotenvQuote(s string) string {
+	if dotenvSafePattern.MatchString(s) {
+		return s
+	}
+
+	return dotenvDoubleQuote(s)
+}
+
+// This function will wrap a dotenv value in double quotes, escaping backslashes, quotes, dollar signs
+// and line breaks
+func dotenvDoubleQuote(s string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "$", "\\$", "\n", "\\n", "\r", "\\r")
+
+	return "\"" + replacer.Replace(s) + "\""
+}
+
+// This function will quote the value in the -quote-style.  The auto style uses the quoting of the
+// format, which only quotes values that need it, while single and double use the single and double
+// quoting of the format.
+func styleQuote(s string, auto func(string) string, single func(string) string, double func(string) string) string {
+	switch quoteStyle {
+	case QUOTE_NONE:
+		return s
+	case QUOTE_SINGLE:
+		return single(s)
+	case QUOTE_DOUBLE:
+		return double(s)
+	}
+
+	return auto(s)
+}
+
+// This function will wrap the string in single quotes as a shell would, so that the value can be
+// sourced.  Nothing is escaped within single quotes, so each single quote in the value closes the
+// quotes, adds an escaped quote and reopens them.
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "'\\''") + "'"
+}
+
+// This function will write each key and value as a line of a Java .properties file
+func writeProperties(w io.Writer, keys []string, dat map[string]interface{}) error {
+	for _, key := range keys {
+		if err := writeComment(w, key); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s=%s\n", propertiesEscape(key, true), propertiesEscape(valueString(dat[key]), false)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will escape a key or value following the rules of java.util.Properties.store.
+// Characters outside of printable ASCII are written as Unicode escapes.
+func propertiesEscape(s string, isKey bool) string {
+	var b strings.Builder
+
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString("\\\\")
+		case r == '\t':
+			b.WriteString("\\t")
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '\f':
+			b.WriteString("\\f")
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString("\\ ")
+		case strings.ContainsRune("=:#!", r):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, "\\u%04X", unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// This function will write the description of the key from -comments-file as a # comment line
+func writeComment(w io.Writer, key string) error {
+	comment, ok := keyComments[key]
+
+	if !ok {
+		return nil
+	}
+
+	_, err := fmt.Fprintf(w, "# %s\n", strings.Join(strings.Fields(comment), " "))
+
+	return err
+}
+
+// This function will write each key and value joined by -kv-sep and followed by -line-sep.  Unlike
+// the pipe format, which is fixed so that get-secrets-layer can read it, both separators are
+// configurable and values can be quoted with -kv-quote so that arbitrary simple formats can be matched.
+// With the auto -quote-style, values are only quoted when -kv-quote is set.
+func writeKeyValue(w io.Writer, keys []string, dat map[string]interface{}) error {
+	auto := func(s string) string { return s }
+
+	if kvQuote {
+		auto = keyValueQuote
+	}
+
+	quote := func(s string) string { return styleQuote(s, auto, singleQuote, doubleQuote) }
+
+	return writeSeparated(w, keys, dat, kvSeparator, lineSeparator, quote)
+}
+
+// This function will write each key and value as a KEY: value line.  This is the keyvalue format
+// with a ": " separator, except that values are also quoted when YAML style readers would otherwise
+// treat them as something other than a plain string.
+func writeColon(w io.Writer, keys []string, dat map[string]interface{}) error {
+	quote := func(s string) string { return styleQuote(s, colonQuote, yamlSingleQuote, doubleQuote) }
+
+	return writeSeparated(w, keys, dat, ": ", "\n", quote)
+}
+
+// This function will write each key and quoted value joined by the separator and followed by the line separator
+func writeSeparated(w io.Writer, keys []string, dat map[string]interface{}, separator string, lineEnd string, quote func(string) string) error {
+	for _, key := range keys {
+		if _, err := io.WriteString(w, key+separator+quote(valueString(dat[key]))+lineEnd); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will double quote a keyvalue value when it could not otherwise be read back unambiguously
+func keyValueQuote(s string) string {
+	needsQuotes := len(s) == 0 || strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s, "\"\\\n\r") ||
+		strings.Contains(s, kvSeparator) || strings.Contains(s, lineSeparator)
+
+	if !needsQuotes {
+		return s
+	}
+
+	return doubleQuote(s)
+}
+
+// This function will double quote a colon format value when it contains a ": " or " #", starts
+// with a character that YAML style readers treat as an indicator, or would be read as a number,
+// boolean or null
+func colonQuote(s string) string {
+	needsQuotes := len(s) == 0 || strings.TrimSpace(s) != s ||
+		strings.ContainsAny(s, "\"\\\n\r\t") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		strings.ContainsRune("-?:,[]{}#&*!|>'%@`", rune(s[0])) ||
+		isYAMLNonString(s)
+
+	if !needsQuotes {
+		return s
+	}
+
+	return doubleQuote(s)
+}
+
+// This function will wrap a colon format value in YAML single quotes, in which a single quote is
+// written as two.  Line breaks cannot be kept on one line within single quotes, so values containing
+// them are double quoted instead.
+func yamlSingleQuote(s string) string {
+	if strings.ContainsAny(s, "\n\r") {
+		return doubleQuote(s)
+	}
+
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// This function will report whether a YAML reader would type the plain scalar as a number, boolean
+// or null rather than a string.  Both the YAML 1.1 and 1.2 forms are checked, so that values such as
+// true, yes, ~, 0123 and 1e3 are never typed.
+func isYAMLNonString(s string) bool {
+	if yamlKeywords[strings.ToLower(s)] {
+		return true
+	}
+
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+
+	_, err := strconv.ParseInt(s, 0, 64)
+
+	return err == nil
+}
+
+// This function will wrap the string in double quotes, escaping backslashes, quotes and line breaks
+func doubleQuote(s string) string {
+	replacer := strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n", "\r", "\\r", "\t", "\\t")
+
+	return "\"" + replacer.Replace(s) + "\""
+}
+
+// This function will expand the escape sequences, such as \n and \t, in a separator supplied on the
+// command line
+func unescapeSeparator(s string) (string, error) {
+	return strconv.Unquote("\"" + strings.ReplaceAll(s, "\"", "\\\"") + "\"")
+}
+
+// This function will write the secret as a Node.js module that exports an object of string values,
+// so that it can be loaded with require().  Keys and values are written as JSON strings, which are
+// valid JavaScript string literals.
+func writeJSModule(w io.Writer, keys []string, dat map[string]interface{}) error {
+	if _, err := fmt.Fprintln(w, "module.exports = {"); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		encodedKey, err := json.Marshal(key)
+
+		if err != nil {
+			return err
+		}
+
+		encodedValue, err := json.Marshal(valueString(dat[key]))
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "    %s: %s,\n", encodedKey, encodedValue); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "};")
+
+	return err
+}
+
+// This function will write the secret as a PHP file that returns an array of string values, so that
+// it can be loaded with include
+func writePHPArray(w io.Writer, keys []string, dat map[string]interface{}) error {
+	if _, err := fmt.Fprint(w, "<?php\nreturn [\n"); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		if _, err := fmt.Fprintf(w, "    %s => %s,\n", phpQuote(key), phpQuote(valueString(dat[key]))); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(w, "];")
+
+	return err
+}
+
+// This function will quote the string as a PHP single quoted string, in which only backslashes and
+// single quotes need to be escaped
+func phpQuote(s string) string {
+	return "'" + strings.NewReplacer("\\", "\\\\", "'", "\\'").Replace(s) + "'"
+}
+
+// This function will write the machine, login and password keys of the secret as a .netrc entry.
+// The -out file is always written with 0600 permissions, which tools such as curl expect of a .netrc.
+func writeNetrc(w io.Writer, keys []string, dat map[string]interface{}) error {
+	tokens := [][2]string{{"machine", netrcMachineKey}, {"login", netrcLoginKey}, {"password", netrcPasswordKey}}
+
+	missing := []string{}
+	for _, token := range tokens {
+		if value, ok := dat[token[1]]; !ok || len(valueString(value)) == 0 {
+			missing = append(missing, token[1])
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("the secret is missing the keys required for %s output: %s", OUTPUT_NETRC, strings.Join(missing, ", "))
+	}
+
+	for i, token := range tokens {
+		value := valueString(dat[token[1]])
+
+		// .netrc has no escaping, so tokens must not contain whitespace.  Quotes are not part of the
+		// format read by every tool, so values that need them are rejected rather than quoted.
+		if strings.IndexFunc(value, unicode.IsSpace) >= 0 || strings.Contains(value, "\"") {
+			return fmt.Errorf("the value of %s cannot be written to a .netrc because it contains whitespace or quotes", token[1])
+		}
+
+		separator := " "
+		if i == len(tokens)-1 {
+			separator = "\n"
+		}
+
+		if _, err := fmt.Fprintf(w, "%s %s%s", token[0], value, separator); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will render the secret as dotenv and base64 encode the result into a single line, so
+// that the whole set can be passed through one environment variable.  The consumer decodes the value
+// and sources it.  When -bundle-var is set the line is written as NAME=BUNDLE.
+func writeEnvBundle(w io.Writer, keys []string, dat map[string]interface{}) error {
+	var dotenv bytes.Buffer
+	if err := writeDotenv(&dotenv, keys, dat); err != nil {
+		return err
+	}
+
+	bundle := base64.StdEncoding.EncodeToString(dotenv.Bytes())
+	if len(bundleVar) > 0 {
+		bundle = bundleVar + "=" + bundle
+	}
+
+	_, err := fmt.Fprintln(w, bundle)
+
+	return err
+}
+
+// A path in a Consul or etcd style key/value store and the value stored at it
+type kvEntry struct {
+	path  string
+	value string
+}
+
+// This function will write each key as a PATH<tab>VALUE line, where the path is the key under
+// -kv-prefix.  Backslashes, tabs and line breaks in the value are escaped so that each entry stays on
+// one line.
+func writeKVPaths(w io.Writer, keys []string, dat map[string]interface{}) error {
+	replacer := strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+	for _, entry := range kvEntries(keys, dat) {
+		if _, err := fmt.Fprintf(w, "%s\t%s\n", entry.path, replacer.Replace(entry.value)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// This function will write the keys as the JSON array read by consul kv import, in which each value
+// is base64 encoded
+func writeKVJSON(w io.Writer, keys []string, dat map[string]interface{}) error {
+	type consulEntry struct {
+		Key   string `json:"key"`
+		Flags int    `json:"flags"`
+		Value string `json:"value"`
+	}
+
+	entries := []consulEntry{}
+	for _, entry := range kvEntries(keys, dat) {
+		entries = append(entries, consulEntry{Key: entry.path, Value: base64.StdEncoding.EncodeToString([]byte(entry.value))})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(entries)
+}
+
+// This function will convert the keys into store paths under -kv-prefix.  Values that are JSON
+// objects are expanded into a path for each of their members, sorted by name.
+func kvEntries(keys []string, dat map[string]interface{}) []kvEntry {
+	prefix := strings.TrimSuffix(kvPrefix, kvPathSeparator)
+
+	entries := []kvEntry{}
+	for _, key := range keys {
+		entries = appendKVEntries(entries, prefix, key, dat[key])
+	}
+
+	return entries
+}
+
+// This function will append the entry for the value at the parent path, or the entries of its
+// members when the value is a JSON object
+func appendKVEntries(entries []kvEntry, parent string, name string, value interface{}) []kvEntry {
+	path := kvPathEscape(name)
+	if len(parent) > 0 {
+		path = parent + kvPathSeparator + path
+	}
+
+	object, ok := value.(map[string]interface{})
+
+	if !ok {
+		return append(entries, kvEntry{path: path, value: valueString(value)})
+	}
+
+	members := []string{}
+	for member := range object {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+
+	for _, member := range members {
+		entries = appendKVEntries(entries, path, member, object[member])
+	}
+
+	return entries
+}
+
+// This function will percent encode the characters of a path segment that would otherwise be read
+// as a path separator or break the line of a kv-paths entry
+func kvPathEscape(s string) string {
+	replacer := strings.NewReplacer("%", "%25", "\t", "%09", "\n", "%0A", "\r", "%0D")
+	escaped := replacer.Replace(s)
+
+	encodedSeparator := ""
+	for _, b := range []byte(kvPathSeparator) {
+		encodedSeparator += fmt.Sprintf("%%%02X", b)
+	}
+
+	return strings.ReplaceAll(escaped, kvPathSeparator, encodedSeparator)
+}
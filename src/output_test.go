@@ -0,0 +1,257 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// Tests for the output formatters and their quoting
+//
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStyleQuote(t *testing.T) {
+	defer func(style string) { quoteStyle = style }(quoteStyle)
+
+	tests := []struct {
+		style    string
+		value    string
+		dotenv   string
+		colon    string
+		keyValue string
+	}{
+		{QUOTE_AUTO, "plain", "plain", "plain", "plain"},
+		{QUOTE_AUTO, "has space", `"has space"`, "has space", "has space"},
+		{QUOTE_AUTO, "true", "true", `"true"`, "true"},
+		{QUOTE_NONE, "has space", "has space", "has space", "has space"},
+		{QUOTE_NONE, "true", "true", "true", "true"},
+		{QUOTE_DOUBLE, "plain", `"plain"`, `"plain"`, `"plain"`},
+		{QUOTE_DOUBLE, `a"$b`, `"a\"\$b"`, `"a\"$b"`, `"a\"$b"`},
+		{QUOTE_SINGLE, "plain", "'plain'", "'plain'", "'plain'"},
+		{QUOTE_SINGLE, "it's", `'it'\''s'`, "'it''s'", `'it'\''s'`},
+		{QUOTE_SINGLE, `a\b$c`, `'a\b$c'`, `'a\b$c'`, `'a\b$c'`},
+		{QUOTE_SINGLE, "l1\nl2", "'l1\nl2'", `"l1\nl2"`, "'l1\nl2'"},
+	}
+
+	for _, test := range tests {
+		quoteStyle = test.style
+
+		if got := styleQuote(test.value, dotenvQuote, singleQuote, dotenvDoubleQuote); got != test.dotenv {
+			t.Errorf("%s dotenv quoting of %q is %q, expected %q", test.style, test.value, got, test.dotenv)
+		}
+
+		if got := styleQuote(test.value, colonQuote, yamlSingleQuote, doubleQuote); got != test.colon {
+			t.Errorf("%s colon quoting of %q is %q, expected %q", test.style, test.value, got, test.colon)
+		}
+
+		if got := styleQuote(test.value, func(s string) string { return s }, singleQuote, doubleQuote); got != test.keyValue {
+			t.Errorf("%s keyvalue quoting of %q is %q, expected %q", test.style, test.value, got, test.keyValue)
+		}
+	}
+}
+
+func TestWriteColonSingleQuoteStaysOnOneLine(t *testing.T) {
+	defer func(style string) { quoteStyle = style }(quoteStyle)
+	quoteStyle = QUOTE_SINGLE
+
+	var output bytes.Buffer
+	if err := writeColon(&output, []string{"A", "B"}, map[string]interface{}{"A": "it's", "B": "l1\nl2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "A: 'it''s'\nB: \"l1\\nl2\"\n"; output.String() != expected {
+		t.Errorf("got %q, expected %q", output.String(), expected)
+	}
+}
+
+func TestColonQuote(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"plain", "plain"},
+		{"p4ss word", "p4ss word"},
+		{"", `""`},
+		{" padded", `" padded"`},
+		{"a: b", `"a: b"`},
+		{"a #b", `"a #b"`},
+		{"a#b", "a#b"},
+		{"ends:", `"ends:"`},
+		{"http://host", "http://host"},
+		{"#comment", `"#comment"`},
+		{"*alias", `"*alias"`},
+		{"[list]", `"[list]"`},
+		{"-1", `"-1"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"tab\there", `"tab\there"`},
+		{"3", `"3"`},
+		{"3a", "3a"},
+	}
+
+	for _, test := range tests {
+		if got := colonQuote(test.value); got != test.expected {
+			t.Errorf("colonQuote(%q) is %q, expected %q", test.value, got, test.expected)
+		}
+	}
+}
+
+func TestIsYAMLNonString(t *testing.T) {
+	nonStrings := []string{"3", "0123", "1e3", "1.5", "0x1F", "0o17", "1_000", "true", "False", "YES", "no", "on", "Off", "y", "N", "null", "NULL", "~", ".inf", "-.Inf", ".NaN"}
+	plainStrings := []string{"abc", "3a", "1.2.3", "truthy", "nul", "0x", "e3", "yes please"}
+
+	for _, value := range nonStrings {
+		if !isYAMLNonString(value) {
+			t.Errorf("%q should be read as a non string", value)
+		}
+	}
+
+	for _, value := range plainStrings {
+		if isYAMLNonString(value) {
+			t.Errorf("%q should be read as a string", value)
+		}
+	}
+}
+
+func TestWriteNetrc(t *testing.T) {
+	defer func(machine, login, password string) {
+		netrcMachineKey, netrcLoginKey, netrcPasswordKey = machine, login, password
+	}(netrcMachineKey, netrcLoginKey, netrcPasswordKey)
+	netrcMachineKey, netrcLoginKey, netrcPasswordKey = DEFAULT_NETRC_MACHINE_KEY, DEFAULT_NETRC_LOGIN_KEY, "token"
+
+	tests := []struct {
+		name     string
+		dat      map[string]interface{}
+		expected string
+		fails    bool
+	}{
+		{"entry", map[string]interface{}{"machine": "example.com", "login": "user", "token": "s3cret", "other": "x"}, "machine example.com login user password s3cret\n", false},
+		{"missing key", map[string]interface{}{"machine": "example.com", "login": "user"}, "", true},
+		{"empty value", map[string]interface{}{"machine": "example.com", "login": "", "token": "s3cret"}, "", true},
+		{"whitespace", map[string]interface{}{"machine": "example.com", "login": "user", "token": "s3 cret"}, "", true},
+		{"quote", map[string]interface{}{"machine": "example.com", "login": "user", "token": `s3"cret`}, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := writeNetrc(&output, nil, test.dat)
+
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, wrote %q", output.String())
+				}
+
+				// The values are secret so they must never be part of the error
+				if strings.Contains(err.Error(), "s3") {
+					t.Errorf("error %q contains the value", err.Error())
+				}
+				return
+			}
+
+			if err != nil || output.String() != test.expected {
+				t.Errorf("got %q and %v, expected %q", output.String(), err, test.expected)
+			}
+		})
+	}
+}
+
+func TestKVPathEscape(t *testing.T) {
+	defer func(separator string) { kvPathSeparator = separator }(kvPathSeparator)
+
+	tests := []struct {
+		separator string
+		segment   string
+		expected  string
+	}{
+		{"/", "plain", "plain"},
+		{"/", "a/b", "a%2Fb"},
+		{"/", "100%", "100%25"},
+		{"/", "%2F", "%252F"},
+		{"/", "tab\tnew\nline\r", "tab%09new%0Aline%0D"},
+		{".", "a.b/c", "a%2Eb/c"},
+		{"::", "a::b:c", "a%3A%3Ab:c"},
+	}
+
+	for _, test := range tests {
+		kvPathSeparator = test.separator
+
+		if got := kvPathEscape(test.segment); got != test.expected {
+			t.Errorf("kvPathEscape(%q) with separator %q is %q, expected %q", test.segment, test.separator, got, test.expected)
+		}
+	}
+}
+
+func TestKVEntries(t *testing.T) {
+	defer func(prefix, separator string) { kvPrefix, kvPathSeparator = prefix, separator }(kvPrefix, kvPathSeparator)
+
+	dat := map[string]interface{}{
+		"DB":    map[string]interface{}{"port": 5432.0, "host": "h", "a/b": "x", "opts": map[string]interface{}{"ssl": true}},
+		"LIST":  []interface{}{1.0, "two"},
+		"EMPTY": map[string]interface{}{},
+		"KEY":   "value",
+	}
+	keys := []string{"KEY", "DB", "LIST", "EMPTY"}
+
+	tests := []struct {
+		name      string
+		prefix    string
+		separator string
+		expected  []kvEntry
+	}{
+		{"no prefix", "", "/", []kvEntry{
+			{"KEY", "value"}, {"DB/a%2Fb", "x"}, {"DB/host", "h"}, {"DB/opts/ssl", "true"}, {"DB/port", "5432"}, {"LIST", `[1,"two"]`},
+		}},
+		{"prefix with trailing separator", "app/config/", "/", []kvEntry{
+			{"app/config/KEY", "value"}, {"app/config/DB/a%2Fb", "x"}, {"app/config/DB/host", "h"}, {"app/config/DB/opts/ssl", "true"}, {"app/config/DB/port", "5432"}, {"app/config/LIST", `[1,"two"]`},
+		}},
+		{"other separator", "app", ".", []kvEntry{
+			{"app.KEY", "value"}, {"app.DB.a/b", "x"}, {"app.DB.host", "h"}, {"app.DB.opts.ssl", "true"}, {"app.DB.port", "5432"}, {"app.LIST", `[1,"two"]`},
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kvPrefix, kvPathSeparator = test.prefix, test.separator
+
+			if entries := kvEntries(keys, dat); !reflect.DeepEqual(entries, test.expected) {
+				t.Errorf("got %v, expected %v", entries, test.expected)
+			}
+		})
+	}
+}
+
+func TestWriteKVPathsAndJSON(t *testing.T) {
+	defer func(prefix, separator string) { kvPrefix, kvPathSeparator = prefix, separator }(kvPrefix, kvPathSeparator)
+	kvPrefix, kvPathSeparator = "app", "/"
+
+	dat := map[string]interface{}{"K": "line1\nline2\ttab\\"}
+
+	var paths bytes.Buffer
+	if err := writeKVPaths(&paths, []string{"K"}, dat); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "app/K\tline1\\nline2\\ttab\\\\\n"; paths.String() != expected {
+		t.Errorf("got %q, expected %q", paths.String(), expected)
+	}
+
+	var encoded bytes.Buffer
+	if err := writeKVJSON(&encoded, []string{"K"}, dat); err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []map[string]interface{}
+	if err := json.Unmarshal(encoded.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []map[string]interface{}{{"key": "app/K", "flags": 0.0, "value": base64.StdEncoding.EncodeToString([]byte("line1\nline2\ttab\\"))}}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("got %v, expected %v", entries, expected)
+	}
+}
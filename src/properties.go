@@ -0,0 +1,187 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code parses secrets stored as the contents of a Java .properties file.  The rules
+// follow java.util.Properties.load: comments, key/value separators, line continuations and
+// escape sequences (including Unicode escapes) are all supported.
+//
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+// A logical line of a .properties file along with the number of the line it starts on
+type propertiesLine struct {
+	text   string
+	number int
+}
+
+// This function will parse the supplied .properties content into a map of keys to values.  An
+// error is returned if the content contains a malformed Unicode escape.  The error only gives the
+// line number, since the content is secret.
+func ParseProperties(content string) (map[string]interface{}, error) {
+	dat := map[string]interface{}{}
+
+	for _, line := range propertiesLogicalLines(content) {
+		key, value, err := splitPropertiesLine(line.text)
+
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line.number, err)
+		}
+
+		dat[key] = value
+	}
+
+	return dat, nil
+}
+
+// This function will split the content into logical lines.  Blank lines and comments are dropped
+// and lines ending in an unescaped backslash are joined with the line that follows, with the
+// leading whitespace of the continuation line removed.
+func propertiesLogicalLines(content string) []propertiesLine {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+
+	lines := []propertiesLine{}
+	current := ""
+	start := 0
+	continuing := false
+
+	for number, raw := range strings.Split(content, "\n") {
+		line := strings.TrimLeft(raw, " \t\f")
+
+		if !continuing && (len(line) == 0 || line[0] == '#' || line[0] == '!') {
+			continue
+		}
+
+		if !continuing {
+			start = number + 1
+		}
+
+		// A line is continued when it ends with an odd number of backslashes
+		trailing := len(line) - len(strings.TrimRight(line, "\\"))
+		if trailing%2 == 1 {
+			current += line[:len(line)-1]
+			continuing = true
+			continue
+		}
+
+		lines = append(lines, propertiesLine{text: current + line, number: start})
+		current = ""
+		continuing = false
+	}
+
+	if continuing && len(current) > 0 {
+		lines = append(lines, propertiesLine{text: current, number: start})
+	}
+
+	return lines
+}
+
+// This function will split a logical line into its unescaped key and value.  The key ends at the
+// first unescaped '=', ':' or whitespace character, and the separator may be surrounded by whitespace.
+func splitPropertiesLine(line string) (string, string, error) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+
+		if strings.IndexByte("=: \t\f", line[i]) >= 0 {
+			end = i
+			break
+		}
+	}
+
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	key, err := unescapeProperties(line[:end])
+
+	if err != nil {
+		return "", "", err
+	}
+
+	value, err := unescapeProperties(rest)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return key, value, nil
+}
+
+// This function will process the escape sequences supported by .properties files
+func unescapeProperties(s string) (string, error) {
+	if !strings.Contains(s, "\\") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i == len(s)-1 {
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			code, err := parseUnicodeEscape(s, i)
+
+			if err != nil {
+				return "", err
+			}
+			i += 4
+
+			// Characters outside the BMP are written as a UTF-16 surrogate pair of escapes
+			if utf16.IsSurrogate(code) {
+				if low, err := parseUnicodeEscape(s, i+2); err == nil && i+1 < len(s) && s[i+1] == '\\' {
+					if r := utf16.DecodeRune(code, low); r != unicode.ReplacementChar {
+						code = r
+						i += 6
+					}
+				}
+			}
+
+			b.WriteRune(code)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String(), nil
+}
+
+// This function will decode the four hex digits following the 'u' at index i of s
+func parseUnicodeEscape(s string, i int) (rune, error) {
+	if i+5 > len(s) || s[i] != 'u' {
+		return 0, errors.New("malformed \\uxxxx encoding")
+	}
+
+	code, err := strconv.ParseUint(s[i+1:i+5], 16, 16)
+
+	if err != nil {
+		return 0, errors.New("malformed \\uxxxx encoding")
+	}
+
+	return rune(code), nil
+}
@@ -0,0 +1,82 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// Tests for the .properties parser
+//
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseProperties(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]interface{}
+	}{
+		{"separators", "a=1\nb:2\nc 3\nd = 4\ne\t:\t5", map[string]interface{}{"a": "1", "b": "2", "c": "3", "d": "4", "e": "5"}},
+		{"comments and blank lines", "# comment\n! comment\n\n  \na=1", map[string]interface{}{"a": "1"}},
+		{"empty value", "a=\nb", map[string]interface{}{"a": "", "b": ""}},
+		{"continuation", "a=one \\\n    two \\\n\tthree", map[string]interface{}{"a": "one two three"}},
+		{"continuation of a comment like line", "a=one\\\n# two", map[string]interface{}{"a": "one# two"}},
+		{"continuation at end of content", "a=one\\", map[string]interface{}{"a": "one"}},
+		{"crlf continuation", "a=one\\\r\n  two\r\nb=3", map[string]interface{}{"a": "onetwo", "b": "3"}},
+		{"even trailing backslashes", "a=one\\\\\nb=two", map[string]interface{}{"a": "one\\", "b": "two"}},
+		{"odd trailing backslashes", "a=one\\\\\\\nb=two", map[string]interface{}{"a": "one\\b=two"}},
+		{"escaped separators in key", "a\\=b\\:c\\ d=1", map[string]interface{}{"a=b:c d": "1"}},
+		{"separator in value", "a=b=c:d", map[string]interface{}{"a": "b=c:d"}},
+		{"escape sequences", "a=\\t\\n\\r\\f\\q\\\\", map[string]interface{}{"a": "\t\n\r\fq\\"}},
+		{"unicode escape", "a=caf\\u00e9", map[string]interface{}{"a": "café"}},
+		{"surrogate pair", "a=\\uD83D\\uDE00", map[string]interface{}{"a": "😀"}},
+		{"lone surrogate", "a=\\uD83Dx", map[string]interface{}{"a": "\uFFFDx"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dat, err := ParseProperties(test.content)
+
+			if err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if !reflect.DeepEqual(dat, test.expected) {
+				t.Errorf("got %q, expected %q", dat, test.expected)
+			}
+		})
+	}
+}
+
+func TestParsePropertiesMalformedEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		line    string
+	}{
+		{"short escape in value", "a=1\nb=\\u12", "line 2:"},
+		{"invalid hex in key", "\\uzzzzsecret=1", "line 1:"},
+		{"escape on continuation", "# c\na=x\\\n  \\u00", "line 2:"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := ParseProperties(test.content)
+
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if !strings.HasPrefix(err.Error(), test.line) {
+				t.Errorf("error %q does not start with %q", err.Error(), test.line)
+			}
+
+			// The content is secret so it must never be part of the error
+			if strings.Contains(err.Error(), "secret") || strings.Contains(err.Error(), "\\u12") || strings.Contains(err.Error(), "zzzz") {
+				t.Errorf("error %q contains the content", err.Error())
+			}
+		})
+	}
+}
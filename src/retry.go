@@ -0,0 +1,172 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code retries API calls with exponential backoff and full jitter.  A simple circuit breaker
+// stops retrying once the service has throttled repeatedly, so that a throttled service fails fast
+// rather than being retried until the deadline.
+//
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+)
+
+// Constants for the retry behavior
+const DEFAULT_MAX_ATTEMPTS = 1
+const RETRY_BASE_DELAY = 100 * time.Millisecond
+const RETRY_MAX_DELAY = 2 * time.Second
+const BREAKER_THROTTLE_LIMIT = 3
+
+// Supported values for -timeout-retry-escalation
+const ESCALATION_NONE = "none"
+const ESCALATION_LINEAR = "linear"
+const ESCALATION_EXPONENTIAL = "exponential"
+
+// The error codes returned by AWS services when a request is throttled
+var throttleErrorCodes = map[string]bool{
+	"Throttling":                true,
+	"ThrottlingException":       true,
+	"ThrottledException":        true,
+	"RequestThrottledException": true,
+	"TooManyRequestsException":  true,
+	"RequestLimitExceeded":      true,
+	"PriorRequestNotComplete":   true,
+}
+
+// A retrier runs an operation up to -max-attempts times, giving each attempt up to its attempt timeout
+type retrier struct {
+	operation      string
+	maxAttempts    int
+	attemptTimeout time.Duration
+	escalation     string
+	random         *rand.Rand
+	throttles      int
+}
+
+// This function will create a retrier for the named operation using -max-attempts.  The jitter is
+// seeded from -retry-jitter-seed when supplied so that tests see the same backoff delays every run.
+func newRetrier(operation string) *retrier {
+	seed := retryJitterSeed
+
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &retrier{
+		operation:      operation,
+		maxAttempts:    maxAttempts,
+		attemptTimeout: time.Duration(attemptTimeout) * time.Millisecond,
+		escalation:     timeoutEscalation,
+		random:         rand.New(rand.NewSource(seed)),
+	}
+}
+
+// This function will call fn until it succeeds, returns an error that cannot be retried, the attempts
+// are exhausted, the circuit breaker opens, or the next backoff would pass the context deadline
+func (r *retrier) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		timedOut, err := r.attempt(ctx, attempt, fn)
+
+		if err == nil || attempt >= r.maxAttempts || !(timedOut || isRetryable(err)) {
+			return err
+		}
+
+		if isThrottle(err) {
+			r.throttles++
+
+			if r.throttles >= BREAKER_THROTTLE_LIMIT {
+				logVerbose("%s circuit breaker opened after %d throttled attempts", r.operation, r.throttles)
+				return fmt.Errorf("%s was throttled %d times, giving up rather than retrying further: %w", r.operation, r.throttles, err)
+			}
+		}
+
+		delay := r.backoff(attempt)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+			logVerbose("%s attempt %d failed and there is not enough time left to retry", r.operation, attempt)
+			return err
+		}
+
+		logVerbose("%s attempt %d of %d failed, retrying in %v: %s", r.operation, attempt, r.maxAttempts, delay, err.Error())
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// This function will make a single attempt, limited to the attempt timeout when there is one.  It
+// reports whether the attempt failed because the attempt timeout, rather than the overall
+// deadline, expired, since that attempt can be retried.
+func (r *retrier) attempt(ctx context.Context, attempt int, fn func(ctx context.Context) error) (bool, error) {
+	if r.attemptTimeout <= 0 {
+		return false, fn(ctx)
+	}
+
+	limit := r.timeoutFor(attempt)
+
+	// The attempt can never run past the overall deadline
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < limit {
+		limit = time.Until(deadline)
+	}
+
+	if r.escalation != ESCALATION_NONE {
+		logVerbose("%s attempt %d timeout is %v", r.operation, attempt, limit)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, limit)
+	defer cancel()
+
+	err := fn(attemptCtx)
+
+	return err != nil && attemptCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil, err
+}
+
+// This function will return the timeout for the attempt, which grows with each retry when
+// -timeout-retry-escalation is linear or exponential
+func (r *retrier) timeoutFor(attempt int) time.Duration {
+	switch r.escalation {
+	case ESCALATION_LINEAR:
+		return r.attemptTimeout * time.Duration(attempt)
+	case ESCALATION_EXPONENTIAL:
+		if attempt < 16 {
+			return r.attemptTimeout << uint(attempt-1)
+		}
+		return r.attemptTimeout << 15
+	}
+
+	return r.attemptTimeout
+}
+
+// This function will return a random delay between zero and the exponential backoff for the attempt
+func (r *retrier) backoff(attempt int) time.Duration {
+	ceiling := RETRY_MAX_DELAY
+	if attempt < 16 && RETRY_BASE_DELAY<<uint(attempt-1) < ceiling {
+		ceiling = RETRY_BASE_DELAY << uint(attempt-1)
+	}
+
+	return time.Duration(r.random.Int63n(int64(ceiling) + 1))
+}
+
+// This function will report whether the SDK considers the error to be retryable
+func isRetryable(err error) bool {
+	return retry.IsErrorRetryables(retry.DefaultRetryables).IsErrorRetryable(err) == aws.TrueTernary
+}
+
+// This function will report whether the error is a throttling response
+func isThrottle(err error) bool {
+	var apiErr smithy.APIError
+
+	return errors.As(err, &apiErr) && throttleErrorCodes[apiErr.ErrorCode()]
+}
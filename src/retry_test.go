@@ -0,0 +1,75 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// Tests for the retrier backoff and circuit breaker
+//
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/smithy-go"
+)
+
+func TestRetrierSeededBackoff(t *testing.T) {
+	defer func(seed int64) { retryJitterSeed = seed }(retryJitterSeed)
+	retryJitterSeed = 42
+
+	first, second := newRetrier("first"), newRetrier("second")
+
+	for attempt := 1; attempt <= 10; attempt++ {
+		a, b := first.backoff(attempt), second.backoff(attempt)
+
+		if a != b {
+			t.Fatalf("attempt %d backoff differs with the same seed: %v and %v", attempt, a, b)
+		}
+
+		if a < 0 || a > RETRY_MAX_DELAY {
+			t.Errorf("attempt %d backoff %v is outside 0 to %v", attempt, a, RETRY_MAX_DELAY)
+		}
+	}
+}
+
+func TestRetrierCircuitBreaker(t *testing.T) {
+	defer func(seed int64, attempts int) { retryJitterSeed, maxAttempts = seed, attempts }(retryJitterSeed, maxAttempts)
+	retryJitterSeed = 1
+	maxAttempts = BREAKER_THROTTLE_LIMIT + 5
+
+	throttle := &smithy.GenericAPIError{Code: "ThrottlingException", Message: "Rate exceeded"}
+
+	calls := 0
+	err := newRetrier("test").Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		return throttle
+	})
+
+	if calls != BREAKER_THROTTLE_LIMIT {
+		t.Errorf("expected the breaker to open after %d calls, made %d", BREAKER_THROTTLE_LIMIT, calls)
+	}
+
+	if !errors.Is(err, throttle) {
+		t.Errorf("expected the throttling error to be wrapped, got %v", err)
+	}
+}
+
+func TestRetrierStopsOnSuccess(t *testing.T) {
+	defer func(seed int64, attempts int) { retryJitterSeed, maxAttempts = seed, attempts }(retryJitterSeed, maxAttempts)
+	retryJitterSeed = 1
+	maxAttempts = 5
+
+	calls := 0
+	err := newRetrier("test").Do(context.Background(), func(ctx context.Context) error {
+		calls++
+		if calls == 1 {
+			return &smithy.GenericAPIError{Code: "ThrottlingException"}
+		}
+		return nil
+	})
+
+	if err != nil || calls != 2 {
+		t.Errorf("expected success on the second call, got %v after %d calls", err, calls)
+	}
+}
@@ -0,0 +1,68 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code verifies the location of a -secure-out file so that secrets written to a file are not
+// accidentally persisted to disk or exposed to other users.
+//
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Returned by isMemoryBacked on platforms where the filesystem type cannot be determined
+var errFilesystemUnsupported = errors.New("the filesystem type cannot be determined on this platform")
+
+// This function will verify that the directory of the -secure-out file is memory backed.  When it is
+// not, the directory must at least not be accessible to other users.  On platforms where the filesystem
+// type cannot be determined, -secure-out-ack must be supplied to acknowledge the weaker check.  Files
+// that already exist must not be symbolic links, which could send the secret somewhere else.
+func VerifySecureOutPath(path string) error {
+	targets := []string{path}
+	if writeChecksum {
+		targets = append(targets, path+".sha256")
+	}
+
+	for _, target := range targets {
+		if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+			return fmt.Errorf("%s already exists and is not a regular file", target)
+		} else if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	dir := filepath.Dir(path)
+
+	memoryBacked, err := isMemoryBacked(dir)
+
+	if errors.Is(err, errFilesystemUnsupported) {
+		if !secureOutAck {
+			return fmt.Errorf("%w; supply -secure-out-ack to write the file after only checking the directory permissions", err)
+		}
+
+		logWarning("Unable to verify that %s is memory backed, %s", dir, err.Error())
+	} else if err != nil {
+		return err
+	} else if memoryBacked {
+		logVerbose("%s is on a memory backed filesystem", dir)
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+
+	if err != nil {
+		return err
+	}
+
+	if info.Mode().Perm()&0007 != 0 {
+		return fmt.Errorf("%s is not memory backed and is accessible to other users (mode %v)", dir, info.Mode().Perm())
+	}
+
+	logVerbose("%s is not memory backed but is only accessible to its owner and group", dir)
+
+	return nil
+}
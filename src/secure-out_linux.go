@@ -0,0 +1,27 @@
+//go:build linux
+// +build linux
+
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+package main
+
+import (
+	"syscall"
+)
+
+// The filesystem magic numbers of memory backed filesystems, from linux/magic.h
+const TMPFS_MAGIC = 0x01021994
+const RAMFS_MAGIC = 0x858458f6
+
+// This function will report whether the directory is on a tmpfs or ramfs filesystem
+func isMemoryBacked(dir string) (bool, error) {
+	var stat syscall.Statfs_t
+
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return false, err
+	}
+
+	return int64(stat.Type) == TMPFS_MAGIC || int64(stat.Type) == RAMFS_MAGIC, nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+package main
+
+// This function cannot determine the filesystem type outside of Linux
+func isMemoryBacked(dir string) (bool, error) {
+	return false, errFilesystemUnsupported
+}
@@ -0,0 +1,44 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code resolves the ARN of the secret to retrieve from an SSM parameter, allowing
+// infrastructure as code to own the wiring of the secret ARN.
+//
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// The shape of a Secrets Manager secret ARN across all partitions
+var secretArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:secretsmanager:[a-z0-9-]+:[0-9]{12}:secret:.+$`)
+
+// This function will read the -arn-from-ssm parameter using the supplied assumed role and return
+// its value once it has been verified to be a secret ARN
+func GetSecretArnFromSSM(ctx context.Context, cfg aws.Config, assumedRole *sts.AssumeRoleOutput) (string, error) {
+	client := ssm.NewFromConfig(RoleConfig(cfg, assumedRole))
+
+	result, err := client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(arnParameter),
+		WithDecryption: true,
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	value := aws.ToString(result.Parameter.Value)
+	if !secretArnPattern.MatchString(value) {
+		// The parameter may be a SecureString, so only its name is reported and never its value
+		return "", fmt.Errorf("the value of parameter %s is not a Secrets Manager secret ARN", arnParameter)
+	}
+
+	return value, nil
+}
@@ -0,0 +1,103 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code resolves credentials for an IAM Identity Center (SSO) role using the access token that
+// the AWS CLI caches after aws sso login --sso-session NAME.
+//
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+)
+
+// The access token cached by the AWS CLI for an sso-session
+type ssoCachedToken struct {
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+	Region      string `json:"region"`
+}
+
+// This function will exchange the cached access token of -sso-session for the credentials of
+// -sso-role in -sso-account
+func SSOCredentials(ctx context.Context, cfg aws.Config) (aws.CredentialsProvider, error) {
+	token, err := readSSOToken(ssoSession)
+
+	if err != nil {
+		return nil, err
+	}
+
+	tokenRegion := ssoRegion
+	if len(tokenRegion) == 0 {
+		tokenRegion = token.Region
+	}
+
+	client := sso.NewFromConfig(cfg, func(o *sso.Options) {
+		if len(tokenRegion) > 0 {
+			o.Region = tokenRegion
+		}
+	})
+
+	result, err := client.GetRoleCredentials(ctx, &sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(token.AccessToken),
+		AccountId:   aws.String(ssoAccount),
+		RoleName:    aws.String(ssoRole),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	logVerbose("Using SSO role %s in account %s from session %s", ssoRole, ssoAccount, ssoSession)
+
+	creds := result.RoleCredentials
+	return aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(aws.ToString(creds.AccessKeyId), aws.ToString(creds.SecretAccessKey), aws.ToString(creds.SessionToken))), nil
+}
+
+// This function will read the cached access token for the sso-session, which the AWS CLI stores in
+// ~/.aws/sso/cache under the SHA-1 of the session name
+func readSSOToken(session string) (*ssoCachedToken, error) {
+	home, err := os.UserHomeDir()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(session))
+	path := filepath.Join(home, ".aws", "sso", "cache", hex.EncodeToString(sum[:])+".json")
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("no cached login for sso-session %s, run aws sso login --sso-session %s: %w", session, session, err)
+	}
+
+	var token ssoCachedToken
+	if err := json.Unmarshal(content, &token); err != nil {
+		return nil, fmt.Errorf("invalid cached login %s: %w", path, err)
+	}
+
+	expiresAt, err := time.Parse(time.RFC3339, token.ExpiresAt)
+
+	if err != nil || len(token.AccessToken) == 0 {
+		return nil, fmt.Errorf("invalid cached login %s", path)
+	}
+
+	if time.Now().After(expiresAt) {
+		return nil, fmt.Errorf("the cached login for sso-session %s expired at %s, run aws sso login --sso-session %s", session, token.ExpiresAt, session)
+	}
+
+	return &token, nil
+}
@@ -0,0 +1,109 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code transforms the values of the secret before they are validated and output.  Only
+// string values are transformed; other JSON values are output unchanged.
+//
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// ANSI CSI sequences, such as colors, and OSC sequences, such as window titles
+var ansiEscapePattern = regexp.MustCompile("\x1b\\[[0-?]*[ -/]*[@-~]|\x1b\\][^\x07\x1b]*(\x07|\x1b\\\\)")
+
+// This function will apply each of the enabled value transforms, in place, to the values of the keys
+// that will be output.  An error is returned when a transform cannot be applied, unless -best-effort
+// is set, in which case a warning is logged and the value is left unchanged.
+func TransformValues(keys []string, dat map[string]interface{}) error {
+	newlineTargets := keySet(newlineKeys)
+	minifyTargets := keySet(minifyJSONKeys)
+	scrubbed := 0
+
+	for _, key := range keys {
+		value, ok := dat[key].(string)
+
+		if !ok {
+			continue
+		}
+
+		// Control characters and terminal escape sequences corrupt terminals and downstream parsers
+		if stripControl {
+			if clean := stripControlCharacters(value); clean != value {
+				value = clean
+				scrubbed++
+			}
+		}
+
+		// PEM keys and certificates are often stored with literal \n sequences, or need them
+		if len(newlineTargets) == 0 || newlineTargets[key] {
+			if normalizeNewlines {
+				value = strings.NewReplacer(`\r\n`, "\n", `\n`, "\n").Replace(value)
+			} else if escapeNewlines {
+				value = strings.NewReplacer("\r\n", `\n`, "\n", `\n`).Replace(value)
+			}
+		}
+
+		// Embedded JSON documents are often stored pretty printed
+		if minifyTargets[key] {
+			var compact bytes.Buffer
+
+			if err := json.Compact(&compact, []byte(value)); err != nil {
+				if !bestEffort {
+					return fmt.Errorf("the value of %s is not valid JSON: %s", key, err.Error())
+				}
+
+				logWarning("The value of %s is not valid JSON and was not minified: %s", key, err.Error())
+			} else {
+				value = compact.String()
+			}
+		}
+
+		dat[key] = value
+	}
+
+	if stripControl {
+		logVerbose("Removed control characters from %d values", scrubbed)
+	}
+
+	return nil
+}
+
+// This function will remove ANSI escape sequences and control characters from the value.  Newlines
+// and tabs are also removed unless -strip-control-keep-whitespace is set.
+func stripControlCharacters(value string) string {
+	value = ansiEscapePattern.ReplaceAllString(value, "")
+
+	return strings.Map(func(r rune) rune {
+		if stripControlKeepWhitespace && (r == '\n' || r == '\r' || r == '\t') {
+			return r
+		}
+
+		if unicode.IsControl(r) {
+			return -1
+		}
+
+		return r
+	}, value)
+}
+
+// This function will convert a comma separated list of keys into a set.  An empty list results in
+// an empty set.
+func keySet(list string) map[string]bool {
+	set := map[string]bool{}
+
+	for _, key := range strings.Split(list, ",") {
+		if key = strings.TrimSpace(key); len(key) > 0 {
+			set[key] = true
+		}
+	}
+
+	return set
+}
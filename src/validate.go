@@ -0,0 +1,104 @@
+//
+// Copyright Amazon.com, Inc. or its affiliates. All Rights Reserved.
+// SPDX-License-Identifier: MIT-0
+//
+// This code validates the values of the secret before they are output.  Errors name the
+// offending keys but never include the values themselves.
+//
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The validators for each type supported in -validate-types-file
+var typeValidators = map[string]func(string) bool{
+	"int": func(value string) bool {
+		_, err := strconv.ParseInt(value, 10, 64)
+		return err == nil
+	},
+	"bool": func(value string) bool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	},
+	"url": func(value string) bool {
+		parsed, err := url.Parse(value)
+		return err == nil && len(parsed.Scheme) > 0 && len(parsed.Host) > 0
+	},
+	"email": func(value string) bool {
+		address, err := mail.ParseAddress(value)
+		return err == nil && address.Address == value
+	},
+}
+
+// This function will return an error listing every key whose value is empty or null
+func RequireNonEmpty(keys []string, dat map[string]interface{}) error {
+	empty := []string{}
+
+	for _, key := range keys {
+		if dat[key] == nil || valueString(dat[key]) == "" {
+			empty = append(empty, key)
+		}
+	}
+
+	if len(empty) > 0 {
+		return fmt.Errorf("the following keys have empty values: %s", strings.Join(empty, ", "))
+	}
+
+	return nil
+}
+
+// This function will check the values of the keys listed in -validate-types-file against the expected
+// types.  Keys that are not listed, or are not being output, are not checked.  Mismatches are returned
+// as an error, or only logged as warnings when -validate-types-warn is set.
+func ValidateTypes(keys []string, dat map[string]interface{}) error {
+	types, err := readAssignmentsFile(validateTypesFile, "type")
+
+	if err != nil {
+		return err
+	}
+
+	for key, expected := range types {
+		if _, ok := typeValidators[expected]; !ok {
+			return fmt.Errorf("unsupported type %s for key %s, supported types are: %s", expected, key, strings.Join(typeNames(), ", "))
+		}
+	}
+
+	mismatches := []string{}
+	for _, key := range keys {
+		expected, ok := types[key]
+
+		if ok && !typeValidators[expected](valueString(dat[key])) {
+			mismatches = append(mismatches, key+" is not a valid "+expected)
+		}
+	}
+
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	if validateTypesWarn {
+		for _, mismatch := range mismatches {
+			logWarning("%s", mismatch)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("the following keys have values of the wrong type: %s", strings.Join(mismatches, ", "))
+}
+
+// This function will return the names of the supported types in sorted order
+func typeNames() []string {
+	names := []string{}
+	for name := range typeValidators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}